@@ -0,0 +1,97 @@
+//go:build !js
+// +build !js
+
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"tmlang-go-compiler/tmlang"
+)
+
+// checkCommand lexes, parses and analyzes each file without emitting any
+// backend output, and reports every diagnostic found. Exits 1 on any error.
+func checkCommand(args []string) {
+	flags := flag.NewFlagSet("check", flag.ExitOnError)
+	diagnosticsFormat := diagnosticsFlag(flags)
+	limits := limitsFlags(flags)
+	reportPath := flags.String("report", "", "write the reachability analysis as JSON to `path` (- for stdout, moving diagnostics to stderr)")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: tmlang check [flags] <file.tm>...")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	if flags.NArg() < 1 {
+		flags.Usage()
+		os.Exit(1)
+	}
+
+	var all tmlang.Diagnostics
+	var reports []fileReport
+	failed := false
+
+	for _, path := range flags.Args() {
+		code, err := os.ReadFile(path)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading file: %v\n", err)
+			failed = true
+			continue
+		}
+
+		result, err := tmlang.Compile(string(code), tmlang.Options{Analyze: true, Limits: *limits, Path: path})
+		if err != nil {
+			failed = true
+		}
+		all = append(all, withFile(path, result.Diagnostics)...)
+		if result.Analysis != nil {
+			reports = append(reports, fileReport{path, result.Analysis})
+		}
+	}
+
+	if *reportPath != "" {
+		if err := writeReport(*reportPath, reports); err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing report: %v\n", err)
+			failed = true
+		}
+	}
+
+	diagnosticsOut := os.Stdout
+	if *reportPath == "-" {
+		diagnosticsOut = os.Stderr // Keep stdout a single JSON document
+	}
+	if *diagnosticsFormat == "json" {
+		writeDiagnosticsJSON(diagnosticsOut, all)
+	} else {
+		printDiagnostics(diagnosticsOut, "", all)
+	}
+
+	if failed {
+		os.Exit(1)
+	}
+}
+
+type fileReport struct {
+	File string `json:"file"`
+	*tmlang.AnalysisReport
+}
+
+func writeReport(path string, reports []fileReport) error {
+	if reports == nil {
+		reports = []fileReport{}
+	}
+	data, err := json.MarshalIndent(reports, "", "  ")
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+
+	if path == "-" {
+		_, err = os.Stdout.Write(data)
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
@@ -0,0 +1,24 @@
+//go:build !js
+// +build !js
+
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"tmlang-go-compiler/dap"
+)
+
+// dapCommand serves the Debug Adapter Protocol on stdin/stdout.
+func dapCommand(args []string) {
+	if len(args) > 0 && args[0] != "--stdio" {
+		fmt.Fprintln(os.Stderr, "Usage: tmlang dap [--stdio]")
+		os.Exit(1)
+	}
+
+	if err := dap.Serve(os.Stdin, os.Stdout); err != nil {
+		fmt.Fprintf(os.Stderr, "dap: %v\n", err)
+		os.Exit(1)
+	}
+}
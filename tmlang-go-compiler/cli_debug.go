@@ -0,0 +1,377 @@
+//go:build !js
+// +build !js
+
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"tmlang-go-compiler/tmlang"
+)
+
+const debugHelp = `Commands:
+  s, step [n]          take n steps (default 1), into CALLed macros
+  n, next              take one step, running over a CALLed macro
+  o, out               run until the current macro returns
+  c, continue          run until a breakpoint or a halt
+  bs, back [n]         undo n steps (default 1)
+  rc, reverse-continue run backwards until a breakpoint or the start
+  g, goto <step>       go to a step, backwards or forwards
+  f, find <pos> <sym>  go back to the first step that wrote sym at position pos
+  b, break <cond>...   stop where every condition holds:
+                         state <name>, symbol <sym>, line [<file>:]<n>
+                       break 12, break lib.tm:12 and break q1 are shorthands
+  d, delete <id>       remove a breakpoint
+  breakpoints          list the breakpoints
+  t, tape [radius]     print the tape around the head (default 10)
+  r, rule              print the rule the next step applies
+  w, where             print the current state's source and CALL stack
+  restart              start over with the same input
+  q, quit              leave the debugger
+An empty line repeats the last command.`
+
+// debugCommand opens an interactive debugger over the interpreter.
+func debugCommand(args []string) {
+	flags := flag.NewFlagSet("debug", flag.ContinueOnError) // Exit with exitError, not 2 (exitCrash)
+	input := flags.String("input", "", "initial tape `contents`")
+	maxSteps := flags.Int("max-steps", 1000000, "pause continue, next and out after `n` steps")
+	maxCells := flags.Int("max-cells", 0, "stop with OUT_OF_TAPE rather than use more than `n` tape cells (default unlimited)")
+	limits := limitsFlags(flags)
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: tmlang debug [flags] <file.tm>")
+		flags.PrintDefaults()
+	}
+	positional, err := parseInterspersed(flags, args)
+	if err != nil {
+		exitParseError(err)
+	}
+
+	if len(positional) != 1 {
+		flags.Usage()
+		os.Exit(exitError)
+	}
+	path := positional[0]
+
+	code, err := os.ReadFile(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading file: %v\n", err)
+		os.Exit(exitError)
+	}
+	result, err := tmlang.Compile(string(code), tmlang.Options{Limits: *limits, Path: path})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Compilation Failed:")
+		printDiagnostics(os.Stderr, path, result.Diagnostics)
+		os.Exit(exitError)
+	}
+	if err := result.IR.Meta.ValidateInput(*input); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(exitError)
+	}
+
+	session := debugSession{path: path, input: *input, out: os.Stdout}
+	session.dbg.InitDebugger(result.Transitions, result.IR.Meta, *input)
+	session.dbg.Sim.MaxCells = *maxCells
+	session.dbg.MaxSteps = *maxSteps
+	session.repl(os.Stdin)
+}
+
+// parseInterspersed parses flags given before, between or after the
+// positional arguments, which the flag package alone stops at, and returns
+// the positional ones.
+func parseInterspersed(flags *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	if err := flags.Parse(args); err != nil {
+		return nil, err
+	}
+	for flags.NArg() > 0 {
+		positional = append(positional, flags.Arg(0))
+		if err := flags.Parse(flags.Args()[1:]); err != nil {
+			return nil, err
+		}
+	}
+	return positional, nil
+}
+
+// debugSession is the REPL state of tmlang debug.
+type debugSession struct {
+	dbg   tmlang.Debugger
+	path  string // Main source file, for locations
+	input string
+	out   io.Writer
+}
+
+func (session *debugSession) repl(in io.Reader) {
+	fmt.Fprintf(session.out, "Debugging %s with input %q. Type help for commands.\n", session.path, session.input)
+	session.printLocation()
+
+	scanner := bufio.NewScanner(in)
+	last := ""
+	for {
+		fmt.Fprint(session.out, "(tmdb) ")
+		if !scanner.Scan() {
+			fmt.Fprintln(session.out)
+			return
+		}
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			line = last
+		}
+		if line == "" {
+			continue
+		}
+		last = line
+
+		fields := strings.Fields(line)
+		if !session.execute(fields[0], fields[1:]) {
+			return
+		}
+	}
+}
+
+// execute runs one command and reports whether the session goes on.
+func (session *debugSession) execute(command string, args []string) bool {
+	dbg := &session.dbg
+	switch command {
+	case "s", "step":
+		n, ok := session.stepCount(args)
+		if !ok {
+			return true
+		}
+		session.report(dbg.Step(n))
+	case "n", "next":
+		session.report(dbg.StepOver())
+	case "o", "out":
+		session.report(dbg.StepOut())
+	case "c", "continue":
+		session.report(dbg.Continue())
+	case "bs", "back":
+		n, ok := session.stepCount(args)
+		if !ok {
+			return true
+		}
+		session.report(dbg.StepBack(n))
+	case "rc", "reverse-continue":
+		session.report(dbg.ReverseContinue())
+	case "g", "goto":
+		step, err := strconv.Atoi(strings.Join(args, ""))
+		if err != nil || step < 0 {
+			fmt.Fprintln(session.out, "Usage: goto <step>")
+			return true
+		}
+		session.report(dbg.GoTo(step))
+	case "f", "find":
+		if len(args) != 2 {
+			fmt.Fprintln(session.out, "Usage: find <position> <symbol>")
+			return true
+		}
+		position, err := strconv.Atoi(args[0])
+		symbol, symbolErr := tmlang.UnquoteSymbol(args[1])
+		if err != nil || symbolErr != nil || len([]rune(symbol)) != 1 {
+			fmt.Fprintln(session.out, "Usage: find <position> <symbol>")
+			return true
+		}
+		if !dbg.FindWrite(position, []rune(symbol)[0]) {
+			fmt.Fprintf(session.out, "No step so far wrote %s at %d\n", tmlang.QuoteSymbol(symbol), position)
+			return true
+		}
+		session.printLocation()
+	case "b", "break":
+		bp, err := parseBreakpoint(args, session.path)
+		if err != nil {
+			fmt.Fprintln(session.out, err)
+			return true
+		}
+		bp = dbg.AddBreakpoint(bp)
+		fmt.Fprintf(session.out, "Breakpoint %d: %s\n", bp.ID, bp)
+		if bp.Line > 0 && !dbg.HasRulesAt(bp.File, bp.Line) {
+			fmt.Fprintf(session.out, "Warning: no rule is written on that line, so it will never stop\n")
+		}
+	case "d", "delete":
+		id, err := strconv.Atoi(strings.Join(args, ""))
+		if err != nil || !dbg.RemoveBreakpoint(id) {
+			fmt.Fprintf(session.out, "No breakpoint %s\n", strings.Join(args, " "))
+		}
+	case "breakpoints":
+		if len(dbg.Breakpoints) == 0 {
+			fmt.Fprintln(session.out, "No breakpoints")
+		}
+		for _, bp := range dbg.Breakpoints {
+			fmt.Fprintf(session.out, "%d: %s\n", bp.ID, bp)
+		}
+	case "t", "tape":
+		radius := 10
+		if len(args) > 0 {
+			if r, err := strconv.Atoi(args[0]); err == nil && r > 0 {
+				radius = r
+			}
+		}
+		session.printTape(radius)
+	case "r", "rule":
+		session.printRule()
+	case "w", "where":
+		session.printWhere()
+	case "restart":
+		dbg.Restart()
+		session.printLocation()
+	case "h", "help":
+		fmt.Fprintln(session.out, debugHelp)
+	case "q", "quit":
+		return false
+	default:
+		fmt.Fprintf(session.out, "Unknown command %q. Type help for commands.\n", command)
+	}
+	return true
+}
+
+// stepCount reads the optional count of step and back, printing an error
+// if it is not a positive number.
+func (session *debugSession) stepCount(args []string) (int, bool) {
+	if len(args) == 0 {
+		return 1, true
+	}
+	count, err := strconv.Atoi(args[0])
+	if err != nil || count < 1 {
+		fmt.Fprintf(session.out, "Invalid step count %q\n", args[0])
+		return 0, false
+	}
+	return count, true
+}
+
+// parseBreakpoint reads the conditions of a break command. A lone number
+// is a line, file:n a line of that file, and anything else a state. Lines
+// of the main file are stored without the file name.
+func parseBreakpoint(args []string, mainFile string) (tmlang.Breakpoint, error) {
+	var bp tmlang.Breakpoint
+	if len(args) == 1 {
+		switch {
+		case isLine(args[0]):
+			args = []string{"line", args[0]}
+		default:
+			args = []string{"state", args[0]}
+		}
+	}
+	if len(args) == 0 || len(args)%2 != 0 {
+		return bp, fmt.Errorf("Usage: break [state <name>] [symbol <sym>] [line [<file>:]<n>]")
+	}
+
+	for i := 0; i < len(args); i += 2 {
+		value := args[i+1]
+		switch args[i] {
+		case "state":
+			bp.State = value
+		case "symbol":
+			symbol, err := tmlang.UnquoteSymbol(value)
+			if err != nil || len([]rune(symbol)) != 1 {
+				return bp, fmt.Errorf("Invalid symbol %s", value)
+			}
+			bp.Symbol = symbol
+		case "line":
+			if !isLine(value) {
+				return bp, fmt.Errorf("Invalid line %s, expected <n> or <file>:<n>", value)
+			}
+			file, line := "", value
+			if colon := strings.LastIndex(value, ":"); colon >= 0 {
+				file, line = value[:colon], value[colon+1:]
+			}
+			if file == mainFile || file == filepath.Base(mainFile) {
+				file = ""
+			}
+			bp.File = file
+			bp.Line, _ = strconv.Atoi(line)
+		default:
+			return bp, fmt.Errorf("Unknown condition %s, expected state, symbol or line", args[i])
+		}
+	}
+	return bp, nil
+}
+
+// isLine reports whether text is a line number, optionally after file:.
+func isLine(text string) bool {
+	if colon := strings.LastIndex(text, ":"); colon >= 0 {
+		text = text[colon+1:]
+	}
+	line, err := strconv.Atoi(text)
+	return err == nil && line > 0
+}
+
+// report prints why the debugger stopped, then where.
+func (session *debugSession) report(stop tmlang.Stop) {
+	sim := &session.dbg.Sim
+	switch stop.Reason {
+	case tmlang.StopBreakpoint:
+		fmt.Fprintf(session.out, "Breakpoint %d: %s\n", stop.Breakpoint.ID, stop.Breakpoint)
+	case tmlang.StopPause:
+		fmt.Fprintf(session.out, "Paused after %d steps\n", session.dbg.MaxSteps)
+	case tmlang.StopHalt:
+		fmt.Fprintf(session.out, "Halted: %s after %d steps\n", sim.Status, sim.Steps)
+	case tmlang.StopStart:
+		fmt.Fprintln(session.out, "At the start of the run")
+	}
+	session.printLocation()
+}
+
+// printLocation prints the step count, state, tape and next rule.
+func (session *debugSession) printLocation() {
+	sim := &session.dbg.Sim
+	fmt.Fprintf(session.out, "Step %d: %s\n", sim.Steps, session.dbg.Sim.Source.Describe(sim.State, session.path))
+	session.printTape(10)
+	if sim.Status == tmlang.StatusRunning {
+		session.printRule()
+	}
+}
+
+func (session *debugSession) printTape(radius int) {
+	sim := &session.dbg.Sim
+	window, head := sim.TapeWindow(radius)
+	var sb strings.Builder
+	for i, cell := range []rune(window) {
+		if i == head {
+			sb.WriteString("[" + string(cell) + "]")
+		} else {
+			sb.WriteString(" " + string(cell) + " ")
+		}
+	}
+	fmt.Fprintf(session.out, "  Tape: %s  head at %d\n", sb.String(), sim.Head)
+}
+
+func (session *debugSession) printRule() {
+	sim := &session.dbg.Sim
+	rule := sim.CurrentRule()
+	if rule == nil {
+		if sim.Status == tmlang.StatusRunning {
+			fmt.Fprintf(session.out, "  Rule: none for %s, the next step crashes\n", tmlang.QuoteSymbol(string(sim.Cell(sim.Head))))
+		} else {
+			fmt.Fprintf(session.out, "  Rule: none, the machine has halted (%s)\n", sim.Status)
+		}
+		return
+	}
+	fmt.Fprintf(session.out, "  Rule: %s, %s -> %s, %s, %s  at %s\n", rule.Src, tmlang.QuoteSymbol(rule.Read), tmlang.QuoteSymbol(rule.Write), rule.Dir, rule.Next, rule.Span.Location(session.path))
+}
+
+func (session *debugSession) printWhere() {
+	sim := &session.dbg.Sim
+	origin, exists := sim.Origin()
+	if !exists {
+		fmt.Fprintf(session.out, "%s has no rules of its own\n", sim.State)
+		return
+	}
+	fmt.Fprintf(session.out, "#0 %s at %s", origin.Name, origin.Span.Location(session.path))
+	if macro := origin.Macro(); macro != "" {
+		fmt.Fprintf(session.out, " in %s", macro)
+	}
+	fmt.Fprintln(session.out)
+	for i := len(origin.Calls) - 1; i >= 0; i-- {
+		caller := "MAIN"
+		if i > 0 {
+			caller = origin.Calls[i-1].Macro
+		}
+		fmt.Fprintf(session.out, "#%d CALL %s at %s in %s\n", len(origin.Calls)-i, origin.Calls[i].Macro, origin.Calls[i].Span.Location(session.path), caller)
+	}
+}
@@ -0,0 +1,183 @@
+//go:build !js
+// +build !js
+
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"tmlang-go-compiler/tmlang"
+)
+
+// fmtCommand formats .tm files. With no files it formats stdin to stdout.
+func fmtCommand(args []string) {
+	flags := flag.NewFlagSet("fmt", flag.ExitOnError)
+	write := flags.Bool("w", false, "write result to the source file instead of stdout")
+	showDiff := flags.Bool("d", false, "display diffs instead of rewriting files")
+	list := flags.Bool("l", false, "list files whose formatting differs")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: tmlang fmt [-w | -d | -l] [file.tm...]")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	if flags.NArg() == 0 {
+		if *write {
+			fmt.Fprintln(os.Stderr, "Error: cannot use -w with standard input")
+			os.Exit(1)
+		}
+		source, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading stdin: %v\n", err)
+			os.Exit(1)
+		}
+		if !formatFile("<stdin>", source, false, *showDiff, *list) {
+			os.Exit(1)
+		}
+		return
+	}
+
+	ok := true
+	for _, path := range flags.Args() {
+		source, err := os.ReadFile(path)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading file: %v\n", err)
+			ok = false
+			continue
+		}
+		ok = formatFile(path, source, *write, *showDiff, *list) && ok
+	}
+	if !ok {
+		os.Exit(1)
+	}
+}
+
+func formatFile(path string, source []byte, write, showDiff, list bool) bool {
+	formatted, err := tmlang.Format(string(source))
+	if err != nil {
+		diagnostics, _ := err.(tmlang.Diagnostics)
+		printDiagnostics(os.Stderr, path, diagnostics)
+		return false
+	}
+
+	changed := !bytes.Equal(source, []byte(formatted))
+
+	if list && changed {
+		fmt.Println(path)
+	}
+	if write && changed {
+		info, err := os.Stat(path)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return false
+		}
+		if err := os.WriteFile(path, []byte(formatted), info.Mode().Perm()); err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing file: %v\n", err)
+			return false
+		}
+	}
+	if showDiff && changed {
+		fmt.Print(unifiedDiff(path, string(source), formatted))
+	}
+	if !write && !showDiff && !list {
+		fmt.Print(formatted)
+	}
+	return true
+}
+
+// unifiedDiff renders a line diff of a and b with three lines of context.
+func unifiedDiff(path, a, b string) string {
+	oldLines := strings.SplitAfter(a, "\n")
+	newLines := strings.SplitAfter(b, "\n")
+	if oldLines[len(oldLines)-1] == "" {
+		oldLines = oldLines[:len(oldLines)-1]
+	}
+	if newLines[len(newLines)-1] == "" {
+		newLines = newLines[:len(newLines)-1]
+	}
+
+	// Longest common subsequence table, lcs[i][j] for oldLines[i:], newLines[j:]
+	lcs := make([][]int, len(oldLines)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(newLines)+1)
+	}
+	for i := len(oldLines) - 1; i >= 0; i-- {
+		for j := len(newLines) - 1; j >= 0; j-- {
+			if oldLines[i] == newLines[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	type edit struct {
+		Op         byte // ' ', '-' or '+'
+		Text       string
+		OldN, NewN int // 1-based line numbers before this edit is applied
+	}
+	var edits []edit
+	i, j := 0, 0
+	for i < len(oldLines) || j < len(newLines) {
+		switch {
+		case i < len(oldLines) && j < len(newLines) && oldLines[i] == newLines[j]:
+			edits = append(edits, edit{' ', oldLines[i], i + 1, j + 1})
+			i++
+			j++
+		case i < len(oldLines) && (j == len(newLines) || lcs[i+1][j] >= lcs[i][j+1]):
+			edits = append(edits, edit{'-', oldLines[i], i + 1, j + 1})
+			i++
+		default:
+			edits = append(edits, edit{'+', newLines[j], i + 1, j + 1})
+			j++
+		}
+	}
+
+	const context = 3
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "--- %s.orig\n+++ %s\n", path, path)
+
+	for start := 0; start < len(edits); {
+		if edits[start].Op == ' ' {
+			start++
+			continue
+		}
+
+		// Grow the hunk while changes are within 2*context lines of each other
+		hunkStart := max(start-context, 0)
+		end := start
+		for k := start; k < len(edits); k++ {
+			if edits[k].Op != ' ' {
+				end = k
+			} else if k-end > 2*context {
+				break
+			}
+		}
+		hunkEnd := min(end+context+1, len(edits))
+
+		oldCount, newCount := 0, 0
+		for _, e := range edits[hunkStart:hunkEnd] {
+			if e.Op != '+' {
+				oldCount++
+			}
+			if e.Op != '-' {
+				newCount++
+			}
+		}
+		fmt.Fprintf(&sb, "@@ -%d,%d +%d,%d @@\n", edits[hunkStart].OldN, oldCount, edits[hunkStart].NewN, newCount)
+		for _, e := range edits[hunkStart:hunkEnd] {
+			text := e.Text
+			if !strings.HasSuffix(text, "\n") {
+				text += "\n\\ No newline at end of file\n"
+			}
+			sb.WriteString(string(e.Op) + text)
+		}
+		start = hunkEnd
+	}
+	return sb.String()
+}
@@ -0,0 +1,300 @@
+//go:build !js
+// +build !js
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"tmlang-go-compiler/tmlang"
+)
+
+// gradeReport is the JSON summary of one submission.
+type gradeReport struct {
+	Submission  string             `json:"submission"`
+	Compiled    bool               `json:"compiled"`
+	Diagnostics tmlang.Diagnostics `json:"diagnostics"`
+	Passed      int                `json:"passed"`
+	Failed      int                `json:"failed"`
+	Total       int                `json:"total"`
+	Seconds     float64            `json:"seconds"`
+	Tests       []gradeTest        `json:"tests"`
+}
+
+// gradeTest is the outcome of one suite case on one submission.
+type gradeTest struct {
+	Name    string  `json:"name"`
+	Line    int     `json:"line"` // Line of the case in the suite file
+	Passed  bool    `json:"passed"`
+	Status  string  `json:"status,omitempty"`
+	Steps   int     `json:"steps"`
+	Tape    string  `json:"tape"`
+	Failure string  `json:"failure,omitempty"`
+	Seconds float64 `json:"seconds"`
+}
+
+// gradeCommand runs every .tm file of a directory against the cases of a
+// test suite file, several submissions at a time, and writes a JUnit XML
+// report and a JSON summary per submission into <out>/submissions, beside
+// one summary.json of the totals that no submission name can clash with.
+// A submission that fails to compile fails every case, and its diagnostics
+// go in both reports.
+func gradeCommand(args []string) {
+	flags := flag.NewFlagSet("grade", flag.ExitOnError)
+	suitePath := flags.String("suite", "", "test suite `file` with a TESTS section (required)")
+	outputDir := flags.String("out", "grading", "write the reports to `dir`")
+	jobs := flags.Int("jobs", runtime.NumCPU(), "grade `n` submissions at a time")
+	limits := limitsFlags(flags)
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: tmlang grade --suite <suite.tm> [flags] <submissions-dir>")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	if flags.NArg() != 1 || *suitePath == "" || *jobs < 1 {
+		flags.Usage()
+		os.Exit(1)
+	}
+
+	source, err := os.ReadFile(*suitePath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading suite: %v\n", err)
+		os.Exit(1)
+	}
+	tests, diagnostics := tmlang.ParseTests(string(source))
+	printDiagnostics(os.Stderr, *suitePath, diagnostics)
+	if diagnostics.HasErrors() {
+		os.Exit(1)
+	}
+
+	submissions, err := filepath.Glob(filepath.Join(flags.Arg(0), "*.tm"))
+	if err != nil || len(submissions) == 0 {
+		fmt.Fprintf(os.Stderr, "Error: no .tm files in %s\n", flags.Arg(0))
+		os.Exit(1)
+	}
+	sort.Strings(submissions)
+	if err := os.MkdirAll(filepath.Join(*outputDir, "submissions"), 0755); err != nil {
+		fmt.Fprintf(os.Stderr, "Error creating output dir: %v\n", err)
+		os.Exit(1)
+	}
+
+	reports := make([]gradeReport, len(submissions))
+	queue := make(chan int)
+	var wg sync.WaitGroup
+	for worker := 0; worker < *jobs; worker++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range queue {
+				reports[i] = gradeSubmission(submissions[i], tests, *limits)
+			}
+		}()
+	}
+	for i := range submissions {
+		queue <- i
+	}
+	close(queue)
+	wg.Wait()
+
+	failed := false
+	for i, report := range reports {
+		baseName := strings.TrimSuffix(filepath.Base(submissions[i]), ".tm")
+		if err := writeGradeReports(filepath.Join(*outputDir, "submissions"), baseName, *suitePath, report); err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing reports: %v\n", err)
+			failed = true
+		}
+		if report.Compiled {
+			fmt.Printf("%s: %d/%d passed\n", report.Submission, report.Passed, report.Total)
+		} else {
+			fmt.Printf("%s: compilation failed\n", report.Submission)
+		}
+	}
+	if err := writeGradeSummary(filepath.Join(*outputDir, "summary.json"), reports); err != nil {
+		fmt.Fprintf(os.Stderr, "Error writing reports: %v\n", err)
+		failed = true
+	}
+	fmt.Printf("\nReports saved to '%s/'\n", *outputDir)
+
+	if failed {
+		os.Exit(1)
+	}
+}
+
+// gradeSubmission compiles one submission and runs every suite case on it.
+func gradeSubmission(path string, tests []tmlang.TestCase, limits tmlang.Limits) gradeReport {
+	started := time.Now()
+	report := gradeReport{Submission: path, Total: len(tests), Tests: []gradeTest{}}
+
+	var result *tmlang.Result
+	code, err := os.ReadFile(path)
+	if err != nil {
+		report.Diagnostics = tmlang.Diagnostics{{File: path, Severity: tmlang.SeverityError, Message: fmt.Sprintf("Error reading file: %v", err)}}
+	} else {
+		result, err = tmlang.Compile(string(code), tmlang.Options{Limits: limits, Path: path})
+		report.Diagnostics = withFile(path, result.Diagnostics)
+		report.Compiled = err == nil
+	}
+	if report.Diagnostics == nil {
+		report.Diagnostics = tmlang.Diagnostics{}
+	}
+
+	for _, test := range tests {
+		outcome := gradeTest{Name: test.String(), Line: test.Span.Start.Line, Failure: "compilation failed"}
+		if report.Compiled {
+			caseStarted := time.Now()
+			run := tmlang.RunTest(result.Transitions, result.IR.Meta, test)
+			outcome = gradeTest{
+				Name:    test.String(),
+				Line:    test.Span.Start.Line,
+				Passed:  run.Passed,
+				Status:  run.Status,
+				Steps:   run.Steps,
+				Tape:    run.Tape,
+				Failure: run.Failure,
+				Seconds: time.Since(caseStarted).Seconds(),
+			}
+		}
+		if outcome.Passed {
+			report.Passed++
+		} else {
+			report.Failed++
+		}
+		report.Tests = append(report.Tests, outcome)
+	}
+	report.Seconds = time.Since(started).Seconds()
+	return report
+}
+
+// writeGradeReports writes <name>.xml and <name>.json for one submission.
+func writeGradeReports(dir string, name string, suitePath string, report gradeReport) error {
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(dir, name+".json"), append(data, '\n'), 0644); err != nil {
+		return err
+	}
+
+	data, err = xml.MarshalIndent(junitReport(name, suitePath, report), "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, name+".xml"), append([]byte(xml.Header), append(data, '\n')...), 0644)
+}
+
+// writeGradeSummary writes one line of totals per submission, without the
+// cases, for a quick overview of the whole class.
+func writeGradeSummary(path string, reports []gradeReport) error {
+	type summary struct {
+		Submission string `json:"submission"`
+		Compiled   bool   `json:"compiled"`
+		Passed     int    `json:"passed"`
+		Failed     int    `json:"failed"`
+		Total      int    `json:"total"`
+	}
+	summaries := make([]summary, len(reports))
+	for i, report := range reports {
+		summaries[i] = summary{report.Submission, report.Compiled, report.Passed, report.Failed, report.Total}
+	}
+	data, err := json.MarshalIndent(summaries, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0644)
+}
+
+// JUnit XML, as read by CI servers and grading tools. Each submission is
+// one testsuite; a failed case is a <failure>, and every case of a
+// submission that does not compile is an <error>.
+type junitTestSuites struct {
+	XMLName  xml.Name         `xml:"testsuites"`
+	Name     string           `xml:"name,attr"`
+	Tests    int              `xml:"tests,attr"`
+	Failures int              `xml:"failures,attr"`
+	Errors   int              `xml:"errors,attr"`
+	Time     string           `xml:"time,attr"`
+	Suites   []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name      string          `xml:"name,attr"`
+	Tests     int             `xml:"tests,attr"`
+	Failures  int             `xml:"failures,attr"`
+	Errors    int             `xml:"errors,attr"`
+	Time      string          `xml:"time,attr"`
+	Cases     []junitTestCase `xml:"testcase"`
+	SystemErr string          `xml:"system-err,omitempty"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	Classname string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitProblem `xml:"failure,omitempty"`
+	Error     *junitProblem `xml:"error,omitempty"`
+	SystemOut string        `xml:"system-out,omitempty"`
+}
+
+type junitProblem struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr"`
+	Text    string `xml:",chardata"`
+}
+
+func junitReport(name string, suitePath string, report gradeReport) junitTestSuites {
+	var diagnostics bytes.Buffer
+	printDiagnostics(&diagnostics, report.Submission, report.Diagnostics)
+
+	suite := junitTestSuite{
+		Name:      name,
+		Tests:     report.Total,
+		Time:      junitTime(report.Seconds),
+		SystemErr: diagnostics.String(),
+	}
+	for _, test := range report.Tests {
+		testCase := junitTestCase{
+			Name:      fmt.Sprintf("%s:%d: %s", filepath.Base(suitePath), test.Line, test.Name),
+			Classname: name,
+			Time:      junitTime(test.Seconds),
+		}
+		switch {
+		case !report.Compiled:
+			testCase.Error = &junitProblem{Message: test.Failure, Type: "compile", Text: diagnostics.String()}
+			suite.Errors++
+		case !test.Passed:
+			detail := ""
+			if test.Status != "" {
+				detail = fmt.Sprintf("%s after %d steps, tape %q", test.Status, test.Steps, test.Tape)
+			}
+			testCase.Failure = &junitProblem{Message: test.Failure, Type: test.Status, Text: detail}
+			suite.Failures++
+		default:
+			testCase.SystemOut = fmt.Sprintf("%s after %d steps, tape %q", test.Status, test.Steps, test.Tape)
+		}
+		suite.Cases = append(suite.Cases, testCase)
+	}
+
+	return junitTestSuites{
+		Name:     report.Submission,
+		Tests:    suite.Tests,
+		Failures: suite.Failures,
+		Errors:   suite.Errors,
+		Time:     suite.Time,
+		Suites:   []junitTestSuite{suite},
+	}
+}
+
+func junitTime(seconds float64) string {
+	return fmt.Sprintf("%.3f", seconds)
+}
@@ -0,0 +1,24 @@
+//go:build !js
+// +build !js
+
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"tmlang-go-compiler/lsp"
+)
+
+// lspCommand serves the Language Server Protocol on stdin/stdout.
+func lspCommand(args []string) {
+	if len(args) > 0 && args[0] != "--stdio" {
+		fmt.Fprintln(os.Stderr, "Usage: tmlang lsp [--stdio]")
+		os.Exit(1)
+	}
+
+	if err := lsp.Serve(os.Stdin, os.Stdout); err != nil {
+		fmt.Fprintf(os.Stderr, "lsp: %v\n", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,135 @@
+//go:build !js
+// +build !js
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"tmlang-go-compiler/tmlang"
+)
+
+// Exit codes for `tmlang run`, one per halt status
+const (
+	exitAccepted  = 0
+	exitRejected  = 1
+	exitCrash     = 2
+	exitTimeout   = 3
+	exitError     = 4
+	exitOutOfTape = 5
+)
+
+// exitParseError exits after a flag error, which the flag package has
+// already printed with the usage: 0 for -h, else exitError.
+func exitParseError(err error) {
+	if err == flag.ErrHelp {
+		os.Exit(0)
+	}
+	os.Exit(exitError)
+}
+
+func runCommand(args []string) {
+	flags := flag.NewFlagSet("run", flag.ContinueOnError) // Exit with exitError, not 2 (exitCrash)
+	inputFile := flags.String("input-file", "", "read the tape input from `path` (- for stdin)")
+	maxSteps := flags.Int("max-steps", 100000, "stop with TIMEOUT after `n` steps")
+	maxCells := flags.Int("max-cells", 0, "stop with OUT_OF_TAPE rather than use more than `n` tape cells (default unlimited)")
+	diagnosticsFormat := diagnosticsFlag(flags)
+	limits := limitsFlags(flags)
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: tmlang run [flags] <file.tm> [input]")
+		fmt.Fprintln(flags.Output(), "Input is taken from the argument, then --input-file, then stdin.")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		exitParseError(err)
+	}
+
+	if flags.NArg() < 1 || flags.NArg() > 2 {
+		flags.Usage()
+		os.Exit(exitError)
+	}
+
+	code, err := os.ReadFile(flags.Arg(0))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading file: %v\n", err)
+		os.Exit(exitError)
+	}
+
+	input, err := readRunInput(flags, *inputFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading input: %v\n", err)
+		os.Exit(exitError)
+	}
+
+	result, err := tmlang.Compile(string(code), tmlang.Options{Limits: *limits, Path: flags.Arg(0)})
+	if err != nil {
+		if *diagnosticsFormat == "text" {
+			fmt.Fprintln(os.Stderr, "Compilation Failed:")
+		}
+		reportDiagnostics(os.Stderr, *diagnosticsFormat, flags.Arg(0), result.Diagnostics)
+		os.Exit(exitError)
+	}
+	if *diagnosticsFormat == "text" {
+		printDiagnostics(os.Stderr, flags.Arg(0), result.Diagnostics) // Warnings only at this point
+	}
+
+	if err := result.IR.Meta.ValidateInput(input); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(exitError)
+	}
+
+	var sim tmlang.Simulator
+	sim.InitSimulator(result.Transitions, result.IR.Meta, input)
+	sim.MaxCells = *maxCells
+	status := sim.Run(*maxSteps)
+
+	tape, head := sim.TapeContents()
+	fmt.Printf("Tape:   %s\n", tape)
+	fmt.Printf("Head:   %d\n", head)
+	fmt.Printf("State:  %s\n", sim.State)
+	fmt.Printf("Steps:  %d\n", sim.Steps)
+	fmt.Printf("Status: %s\n", status)
+	if status == tmlang.StatusCrash || status == tmlang.StatusTimeout || status == tmlang.StatusOutOfTape {
+		if origin, ok := sim.Origin(); ok {
+			fmt.Printf("Source: %s\n", origin.Describe(flags.Arg(0)))
+		}
+	}
+
+	switch status {
+	case tmlang.StatusAccepted:
+		os.Exit(exitAccepted)
+	case tmlang.StatusRejected:
+		os.Exit(exitRejected)
+	case tmlang.StatusCrash:
+		os.Exit(exitCrash)
+	case tmlang.StatusOutOfTape:
+		os.Exit(exitOutOfTape)
+	default:
+		os.Exit(exitTimeout)
+	}
+}
+
+// readRunInput picks the tape input from the positional argument, the
+// --input-file flag or stdin, in that order.
+func readRunInput(flags *flag.FlagSet, inputFile string) (string, error) {
+	if flags.NArg() == 2 {
+		return flags.Arg(1), nil
+	}
+
+	var data []byte
+	var err error
+	if inputFile != "" && inputFile != "-" {
+		data, err = os.ReadFile(inputFile)
+	} else {
+		data, err = io.ReadAll(os.Stdin)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
@@ -0,0 +1,93 @@
+//go:build !js
+// +build !js
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"tmlang-go-compiler/tmlang"
+)
+
+// testCommand compiles each file and runs the cases of its TESTS section
+// with the interpreter. Exits 1 if any case fails or any file fails to
+// compile.
+func testCommand(args []string) {
+	flags := flag.NewFlagSet("test", flag.ExitOnError)
+	limits := limitsFlags(flags)
+	failuresOnly := flags.Bool("failures", false, "only print the cases that fail")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: tmlang test [flags] <file.tm>...")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	if flags.NArg() < 1 {
+		flags.Usage()
+		os.Exit(1)
+	}
+
+	failed := false
+	for _, path := range flags.Args() {
+		code, err := os.ReadFile(path)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading file: %v\n", err)
+			failed = true
+			continue
+		}
+
+		result, err := tmlang.Compile(string(code), tmlang.Options{Limits: *limits, Path: path})
+		if err != nil {
+			fmt.Printf("FAIL %s: compilation failed\n", path)
+			printDiagnostics(os.Stdout, path, result.Diagnostics.Errors())
+			failed = true
+			continue
+		}
+		if len(result.IR.Tests) == 0 {
+			fmt.Printf("?    %s: no TESTS section\n", path)
+			continue
+		}
+
+		passed := 0
+		for _, test := range tmlang.RunTests(result) {
+			if test.Passed {
+				passed++
+				if *failuresOnly {
+					continue
+				}
+			}
+			printTestResult(path, test)
+		}
+
+		verdict := "ok  "
+		if passed < len(result.IR.Tests) {
+			verdict = "FAIL"
+			failed = true
+		}
+		fmt.Printf("%s %s: %d passed, %d failed\n", verdict, path, passed, len(result.IR.Tests)-passed)
+	}
+
+	if failed {
+		os.Exit(1)
+	}
+}
+
+// printTestResult prints one case as
+// PASS prog.tm:12: "0110" -> ACCEPT (ACCEPTED after 34 steps, tape "0110"),
+// followed by the reason on failure.
+func printTestResult(path string, test tmlang.TestResult) {
+	verdict := "PASS"
+	if !test.Passed {
+		verdict = "FAIL"
+	}
+	fmt.Printf("%s %s:%d: %s", verdict, path, test.Test.Span.Start.Line, test.Test)
+	if test.Status != "" {
+		fmt.Printf(" (%s after %d steps, tape %q)", test.Status, test.Steps, test.Tape)
+	}
+	fmt.Println()
+	if !test.Passed {
+		fmt.Printf("    %s\n", test.Failure)
+	}
+}
@@ -0,0 +1,531 @@
+// Package dap implements a Debug Adapter Protocol server for TM-Lang over
+// stdio, built on the interpreter's tmlang.Debugger.
+package dap
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"tmlang-go-compiler/tmlang"
+)
+
+// Server holds one debugging session: a single program, launched once.
+type Server struct {
+	reader *bufio.Reader
+	writer io.Writer
+	seq    int
+
+	lineOffset   int // Added to 1-based lines for the client, -1 if it counts from 0
+	columnOffset int
+
+	launch     LaunchArguments
+	program    string // Absolute path of the launched program
+	launched   bool
+	configured bool
+	started    bool
+	dbg        tmlang.Debugger
+
+	sources    map[string][]SourceBreakpoint // Breakpoints by source path, as last set
+	ids        map[string][]int              // Debugger breakpoint IDs by source path
+	stdSources []string                      // std: files by sourceReference-1
+}
+
+// Serve runs the server until the client disconnects or in is closed.
+func Serve(in io.Reader, out io.Writer) error {
+	server := &Server{
+		reader:  bufio.NewReader(in),
+		writer:  out,
+		sources: make(map[string][]SourceBreakpoint),
+		ids:     make(map[string][]int),
+	}
+
+	for {
+		body, err := server.readMessage()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		var req request
+		if err := json.Unmarshal(body, &req); err != nil || req.Type != "request" {
+			continue // Nothing sensible to reply to
+		}
+		if err := server.handle(req); err != nil {
+			return err
+		}
+		if req.Command == "disconnect" {
+			return nil
+		}
+	}
+}
+
+// readMessage reads one Content-Length framed message body, as in LSP.
+func (server *Server) readMessage() ([]byte, error) {
+	headers, err := textproto.NewReader(server.reader).ReadMIMEHeader()
+	if err != nil {
+		return nil, err
+	}
+	length, err := strconv.Atoi(headers.Get("Content-Length"))
+	if err != nil {
+		return nil, fmt.Errorf("bad Content-Length header: %w", err)
+	}
+
+	body := make([]byte, length)
+	_, err = io.ReadFull(server.reader, body)
+	return body, err
+}
+
+func (server *Server) writeMessage(message any) error {
+	body, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(server.writer, "Content-Length: %d\r\n\r\n%s", len(body), body)
+	return err
+}
+
+func (server *Server) respond(req request, body any) error {
+	server.seq++
+	return server.writeMessage(response{Seq: server.seq, Type: "response", RequestSeq: req.Seq, Success: true, Command: req.Command, Body: body})
+}
+
+func (server *Server) fail(req request, format string, args ...any) error {
+	server.seq++
+	return server.writeMessage(response{Seq: server.seq, Type: "response", RequestSeq: req.Seq, Command: req.Command, Message: fmt.Sprintf(format, args...)})
+}
+
+func (server *Server) send(name string, body any) error {
+	server.seq++
+	return server.writeMessage(event{Seq: server.seq, Type: "event", Event: name, Body: body})
+}
+
+// handle answers one request, followed by any events it causes. Only
+// errors writing to the client are returned.
+func (server *Server) handle(req request) error {
+	switch req.Command {
+	case "initialize":
+		var args InitializeArguments
+		json.Unmarshal(req.Arguments, &args)
+		if args.LinesStartAt1 != nil && !*args.LinesStartAt1 {
+			server.lineOffset = -1
+		}
+		if args.ColumnsStartAt1 != nil && !*args.ColumnsStartAt1 {
+			server.columnOffset = -1
+		}
+		return server.respond(req, map[string]any{
+			"supportsConfigurationDoneRequest": true,
+			"supportsConditionalBreakpoints":   true,
+			"supportsStepBack":                 true,
+			"supportsRestartRequest":           true,
+			"supportsTerminateRequest":         true,
+		})
+
+	case "launch":
+		var args LaunchArguments
+		if err := json.Unmarshal(req.Arguments, &args); err != nil || args.Program == "" {
+			return server.fail(req, "launch needs a program")
+		}
+		if server.launched {
+			return server.fail(req, "a program is already launched")
+		}
+		server.launch = args
+		if message := server.load(); message != "" {
+			return server.fail(req, "%s", message)
+		}
+		if err := server.respond(req, nil); err != nil {
+			return err
+		}
+		// Only now can breakpoints be given the IDs they keep, so the
+		// client is asked for them after the program is loaded
+		if err := server.send("initialized", nil); err != nil {
+			return err
+		}
+		return server.start()
+	case "setBreakpoints":
+		var args SetBreakpointsArguments
+		if err := json.Unmarshal(req.Arguments, &args); err != nil {
+			return server.fail(req, "%v", err)
+		}
+		path := filepath.Clean(args.Source.Path)
+		if args.Source.Path == "" {
+			path = args.Source.Name // A std: library, which only has a name
+		}
+		server.sources[path] = args.Breakpoints
+		return server.respond(req, map[string]any{"breakpoints": server.applyBreakpoints(path)})
+	case "setExceptionBreakpoints":
+		return server.respond(req, map[string]any{"breakpoints": []Breakpoint{}})
+	case "configurationDone":
+		server.configured = true
+		if err := server.respond(req, nil); err != nil {
+			return err
+		}
+		return server.start()
+
+	case "threads":
+		return server.respond(req, map[string]any{"threads": []Thread{{ID: threadID, Name: "machine"}}})
+	case "stackTrace":
+		frames := server.stackFrames()
+		return server.respond(req, map[string]any{"stackFrames": frames, "totalFrames": len(frames)})
+	case "scopes":
+		return server.respond(req, map[string]any{"scopes": []Scope{
+			{Name: "Machine", VariablesReference: machineScope},
+			{Name: "Tape", VariablesReference: tapeScope},
+		}})
+	case "variables":
+		var args VariablesArguments
+		json.Unmarshal(req.Arguments, &args)
+		return server.respond(req, map[string]any{"variables": server.variables(args.VariablesReference)})
+	case "source":
+		var args SourceArguments
+		json.Unmarshal(req.Arguments, &args)
+		ref := args.SourceReference
+		if args.Source != nil && args.Source.SourceReference > 0 {
+			ref = args.Source.SourceReference
+		}
+		if ref < 1 || ref > len(server.stdSources) {
+			return server.fail(req, "unknown source")
+		}
+		source, err := tmlang.StdSource(server.stdSources[ref-1])
+		if err != nil {
+			return server.fail(req, "%v", err)
+		}
+		return server.respond(req, map[string]any{"content": source})
+
+	case "continue", "next", "stepIn", "stepOut", "stepBack", "reverseContinue":
+		if !server.started {
+			return server.fail(req, "the program is not running")
+		}
+		if err := server.respond(req, map[string]any{"allThreadsContinued": true}); err != nil {
+			return err
+		}
+		return server.report(server.execute(req.Command))
+	case "pause":
+		return server.respond(req, nil) // Runs end before the next request is read
+	case "restart":
+		if !server.started {
+			return server.fail(req, "the program is not running")
+		}
+		server.dbg.Restart()
+		if err := server.respond(req, nil); err != nil {
+			return err
+		}
+		return server.send("stopped", StoppedEventBody{Reason: "entry", ThreadID: threadID, AllThreadsStopped: true})
+	case "terminate":
+		if err := server.respond(req, nil); err != nil {
+			return err
+		}
+		return server.send("terminated", nil)
+	case "disconnect":
+		return server.respond(req, nil)
+	}
+	return server.fail(req, "unsupported request %s", req.Command)
+}
+
+// load compiles the launched program and sets up the debugger, returning
+// the compile errors, if any.
+func (server *Server) load() string {
+	program, err := filepath.Abs(server.launch.Program)
+	if err != nil {
+		return err.Error()
+	}
+	server.program = program
+	code, err := os.ReadFile(program)
+	if err != nil {
+		return fmt.Sprintf("Error reading file: %v", err)
+	}
+	result, err := tmlang.Compile(string(code), tmlang.Options{Path: program})
+	if err != nil {
+		var sb strings.Builder
+		sb.WriteString("Compilation Failed:")
+		for _, d := range result.Diagnostics.Errors() {
+			file := program
+			if d.File != "" {
+				file = d.File
+			}
+			sb.WriteString("\n" + file + ":" + d.Error())
+		}
+		return sb.String()
+	}
+	if err := result.IR.Meta.ValidateInput(server.launch.Input); err != nil {
+		return err.Error()
+	}
+
+	server.dbg.InitDebugger(result.Transitions, result.IR.Meta, server.launch.Input)
+	server.dbg.Sim.MaxCells = server.launch.MaxCells
+	server.dbg.MaxSteps = server.launch.MaxSteps
+	if server.dbg.MaxSteps == 0 {
+		server.dbg.MaxSteps = defaultSteps
+	}
+	server.launched = true
+	for path := range server.sources {
+		server.applyBreakpoints(path)
+	}
+	return ""
+}
+
+// start runs the machine once it is both launched and configured: to the
+// first breakpoint, or not at all with stopOnEntry. Without debugging it
+// runs to the end and the session terminates.
+func (server *Server) start() error {
+	if !server.launched || !server.configured || server.started {
+		return nil
+	}
+	server.started = true
+
+	if server.launch.NoDebug {
+		sim := &server.dbg.Sim
+		sim.Record = false
+		sim.Run(server.dbg.MaxSteps)
+		if err := server.output(sim); err != nil {
+			return err
+		}
+		return server.send("terminated", nil)
+	}
+	if server.launch.StopOnEntry {
+		return server.send("stopped", StoppedEventBody{Reason: "entry", ThreadID: threadID, AllThreadsStopped: true})
+	}
+	if bp := server.dbg.Hit(); bp != nil {
+		return server.report(tmlang.Stop{Reason: tmlang.StopBreakpoint, Breakpoint: bp})
+	}
+	return server.report(server.dbg.Continue())
+}
+
+// execute runs one stepping request. Stepping in goes into CALLed macros
+// one rule at a time; next and stepOut run over them as in tmlang debug.
+func (server *Server) execute(command string) tmlang.Stop {
+	dbg := &server.dbg
+	switch command {
+	case "next":
+		return dbg.StepOver()
+	case "stepIn":
+		return dbg.Step(1)
+	case "stepOut":
+		return dbg.StepOut()
+	case "stepBack":
+		return dbg.StepBack(1)
+	case "reverseContinue":
+		return dbg.ReverseContinue()
+	}
+	return dbg.Continue()
+}
+
+// report sends the stopped event for stop. A halted machine stays
+// stopped rather than terminating, so it can still be inspected or run
+// backwards.
+func (server *Server) report(stop tmlang.Stop) error {
+	sim := &server.dbg.Sim
+	body := StoppedEventBody{Reason: "step", ThreadID: threadID, AllThreadsStopped: true}
+	switch stop.Reason {
+	case tmlang.StopBreakpoint:
+		body.Reason = "breakpoint"
+		body.Description = "Breakpoint: " + stop.Breakpoint.String()
+		body.HitBreakpointIDs = []int{stop.Breakpoint.ID}
+	case tmlang.StopPause:
+		body.Reason = "pause"
+		body.Description = fmt.Sprintf("Paused after %d steps", server.dbg.MaxSteps)
+	case tmlang.StopStart:
+		body.Reason = "entry"
+		body.Description = "At the start of the run"
+	case tmlang.StopHalt:
+		body.Reason = "halt"
+		if sim.Status != tmlang.StatusAccepted && sim.Status != tmlang.StatusRejected {
+			body.Reason = "exception"
+		}
+		body.Description = fmt.Sprintf("%s after %d steps", sim.Status, sim.Steps)
+		body.Text = sim.Status
+		if err := server.output(sim); err != nil {
+			return err
+		}
+	}
+	return server.send("stopped", body)
+}
+
+// output prints how the machine ended to the debug console.
+func (server *Server) output(sim *tmlang.Simulator) error {
+	tape, _ := sim.TapeContents()
+	text := fmt.Sprintf("Halted: %s after %d steps\nTape: %s\n", sim.Status, sim.Steps, tape)
+	return server.send("output", OutputEventBody{Category: "console", Output: text})
+}
+
+// applyBreakpoints replaces the debugger's breakpoints in path with those
+// last set there, returning how each was taken. Before launch they are
+// only kept for later, and unverified until then.
+func (server *Server) applyBreakpoints(path string) []Breakpoint {
+	if server.launched {
+		for _, id := range server.ids[path] {
+			server.dbg.RemoveBreakpoint(id)
+		}
+		server.ids[path] = nil
+	}
+
+	taken := []Breakpoint{}
+	for _, requested := range server.sources[path] {
+		line := requested.Line - server.lineOffset
+		bp := tmlang.Breakpoint{File: path, Line: line}
+		if path == server.program {
+			bp.File = ""
+		}
+		result := Breakpoint{Verified: true, Line: requested.Line, Source: server.source(path)}
+		if err := parseCondition(requested.Condition, &bp); err != nil {
+			result.Verified = false
+			result.Message = err.Error()
+		} else if !server.launched {
+			result.Verified = false
+			result.Message = "Set once the program is launched"
+		} else {
+			bp = server.dbg.AddBreakpoint(bp)
+			server.ids[path] = append(server.ids[path], bp.ID)
+			result.ID = bp.ID
+			if !server.dbg.HasRulesAt(bp.File, line) {
+				result.Verified = false
+				result.Message = "No rule is written on this line"
+			}
+		}
+		taken = append(taken, result)
+	}
+	return taken
+}
+
+// parseCondition reads a breakpoint condition into bp: conditions on the
+// symbol under the head or the state, as in tmlang debug's break command,
+// joined by && or commas, with an optional ==. For example
+// "symbol == 1 && state q2".
+func parseCondition(condition string, bp *tmlang.Breakpoint) error {
+	condition = strings.ReplaceAll(condition, "&&", ",")
+	for _, part := range strings.Split(condition, ",") {
+		fields := strings.Fields(strings.Replace(part, "==", " ", 1))
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) != 2 {
+			return fmt.Errorf("Invalid condition %q, expected symbol <sym> or state <name>", strings.TrimSpace(part))
+		}
+		switch fields[0] {
+		case "symbol":
+			symbol, err := tmlang.UnquoteSymbol(fields[1])
+			if err != nil || len([]rune(symbol)) != 1 {
+				return fmt.Errorf("Invalid symbol %s", fields[1])
+			}
+			bp.Symbol = symbol
+		case "state":
+			bp.State = fields[1]
+		default:
+			return fmt.Errorf("Unknown condition %s, expected symbol or state", fields[0])
+		}
+	}
+	return nil
+}
+
+// stackFrames lists the rule the next step applies, then each CALL that
+// led to its macro instance, innermost first.
+func (server *Server) stackFrames() []StackFrame {
+	frames := []StackFrame{}
+	if !server.launched {
+		return frames
+	}
+	sim := &server.dbg.Sim
+	origin, exists := sim.Origin()
+	if !exists {
+		return append(frames, StackFrame{ID: 0, Name: sim.State})
+	}
+
+	span := origin.Span
+	if rule := sim.CurrentRule(); rule != nil {
+		span = rule.Span
+	}
+	frames = append(frames, server.frame(0, callerName(origin.Calls, len(origin.Calls))+": "+origin.Name, span))
+	for i := len(origin.Calls) - 1; i >= 0; i-- {
+		name := callerName(origin.Calls, i) + ": CALL " + origin.Calls[i].Macro
+		frames = append(frames, server.frame(len(frames), name, origin.Calls[i].Span))
+	}
+	return frames
+}
+
+// callerName is the macro that made calls[i], or MAIN for the outermost.
+func callerName(calls []tmlang.CallSite, i int) string {
+	if i == 0 {
+		return "MAIN"
+	}
+	return calls[i-1].Macro
+}
+
+func (server *Server) frame(id int, name string, span tmlang.Span) StackFrame {
+	return StackFrame{
+		ID:     id,
+		Name:   name,
+		Source: server.source(span.File),
+		Line:   span.Start.Line + server.lineOffset,
+		Column: span.Start.Column + server.columnOffset,
+	}
+}
+
+// source describes a span's file: a path, or for std: libraries a
+// reference the client fetches with a source request.
+func (server *Server) source(file string) *Source {
+	if file == "" {
+		file = server.program
+	}
+	if !tmlang.IsStdFile(file) {
+		return &Source{Name: filepath.Base(file), Path: file}
+	}
+	for i, std := range server.stdSources {
+		if std == file {
+			return &Source{Name: file, SourceReference: i + 1}
+		}
+	}
+	server.stdSources = append(server.stdSources, file)
+	return &Source{Name: file, SourceReference: len(server.stdSources)}
+}
+
+// variables lists the machine's registers, or the cells around the head.
+func (server *Server) variables(reference int) []Variable {
+	variables := []Variable{}
+	if !server.launched {
+		return variables
+	}
+	sim := &server.dbg.Sim
+
+	if reference == tapeScope {
+		for position := sim.Head - tapeRadius; position < sim.Head+tapeRadius; position++ {
+			name := strconv.Itoa(position)
+			if position == sim.Head {
+				name += " (head)"
+			}
+			variables = append(variables, Variable{Name: name, Value: tmlang.QuoteSymbol(string(sim.Cell(position)))})
+		}
+		return variables
+	}
+	if reference != machineScope {
+		return variables
+	}
+
+	add := func(name string, value string) {
+		variables = append(variables, Variable{Name: name, Value: value})
+	}
+	add("state", sim.State)
+	if origin, exists := sim.Origin(); exists {
+		add("written as", origin.Name)
+		if macro := origin.Macro(); macro != "" {
+			add("macro", macro)
+		}
+	}
+	add("symbol", tmlang.QuoteSymbol(string(sim.Cell(sim.Head))))
+	add("head", strconv.Itoa(sim.Head))
+	add("steps", strconv.Itoa(sim.Steps))
+	add("status", sim.Status)
+	if rule := sim.CurrentRule(); rule != nil {
+		add("rule", fmt.Sprintf("%s, %s -> %s, %s, %s", rule.Src, tmlang.QuoteSymbol(rule.Read), tmlang.QuoteSymbol(rule.Write), rule.Dir, rule.Next))
+	}
+	tape, _ := sim.TapeContents()
+	add("tape", strconv.Quote(tape))
+	return variables
+}
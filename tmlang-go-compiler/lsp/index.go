@@ -0,0 +1,269 @@
+package lsp
+
+import (
+	"net/url"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	"tmlang-go-compiler/tmlang"
+)
+
+// Roles an identifier can play at one place in the source.
+const (
+	roleSource  = "source"  // q0 in "q0, 1 -> ..."
+	roleTarget  = "target"  // The next or return state of a transition
+	roleConfig  = "config"  // START:/ACCEPT:/REJECT: value
+	roleDefine  = "define"  // DEF <name>:
+	roleCallRef = "callref" // CALL <name>
+)
+
+// occurrence is one mention of a state or macro name.
+type occurrence struct {
+	Macro bool   // Macro name rather than a state
+	Scope string // Enclosing macro for macro-local states, "" for MAIN
+	Name  string
+	Role  string
+	Span  tmlang.Span
+}
+
+func (occ occurrence) sameSymbol(other occurrence) bool {
+	return occ.Macro == other.Macro && occ.Scope == other.Scope && occ.Name == other.Name
+}
+
+// document is an open .tm file along with its last compile.
+type document struct {
+	URI         string
+	Version     int
+	Text        string
+	Lines       []string
+	Result      *tmlang.Result
+	Occurrences []occurrence
+}
+
+func newDocument(uri string, version int, text string) *document {
+	doc := &document{URI: uri, Version: version, Text: text}
+	doc.Lines = strings.Split(text, "\n")
+	doc.Result, _ = tmlang.Compile(text, tmlang.Options{Path: uriPath(uri)})
+	doc.indexSymbols()
+	return doc
+}
+
+// uriPath returns the local path of a file:// URI, so IMPORTs resolve next to
+// the document, or "" for other schemes.
+func uriPath(uri string) string {
+	parsed, err := url.Parse(uri)
+	if err != nil || parsed.Scheme != "file" {
+		return ""
+	}
+	return filepath.FromSlash(parsed.Path)
+}
+
+// fileURI is the file:// URI of a path reported in an IMPORTed file's spans.
+func fileURI(path string) string {
+	if absolute, err := filepath.Abs(path); err == nil {
+		path = absolute
+	}
+	return (&url.URL{Scheme: "file", Path: filepath.ToSlash(path)}).String()
+}
+
+// importedLocation is where span is in an IMPORTed file. There is no text
+// to convert its columns with, so it is exact for ASCII. std: libraries are
+// built into the compiler and have no file to point at.
+func importedLocation(span tmlang.Span) (Location, bool) {
+	if tmlang.IsStdFile(span.File) {
+		return Location{}, false
+	}
+	start := Position{span.Start.Line - 1, span.Start.Column - 1}
+	end := Position{span.End.Line - 1, span.End.Column - 1}
+	return Location{URI: fileURI(span.File), Range: Range{start, end}}, true
+}
+
+func (doc *document) indexSymbols() {
+	ir := doc.Result.IR
+
+	for key, span := range ir.ConfigSpans {
+		name := ""
+		switch key {
+		case "START:":
+			name = ir.Meta.Start
+		case "ACCEPT:":
+			name = ir.Meta.Accept
+		case "REJECT:":
+			name = ir.Meta.Reject
+		default:
+			continue // BLANK:, INPUT: and TAPE: hold symbols, not states
+		}
+		doc.Occurrences = append(doc.Occurrences, occurrence{Name: name, Role: roleConfig, Span: span})
+	}
+
+	for _, macro := range ir.Macros {
+		if macro.Span.File != "" {
+			continue // IMPORTed: only its CALLs are in this document
+		}
+		doc.Occurrences = append(doc.Occurrences, occurrence{Macro: true, Name: macro.Name, Role: roleDefine, Span: macro.Span})
+		for _, transition := range macro.Body {
+			doc.indexTransition(macro.Name, transition)
+		}
+	}
+
+	for _, transition := range ir.Main {
+		doc.indexTransition("", transition)
+	}
+}
+
+func (doc *document) indexTransition(scope string, transition tmlang.Transition) {
+	doc.Occurrences = append(doc.Occurrences, occurrence{Scope: scope, Name: transition.Src, Role: roleSource, Span: transition.SrcSpan})
+
+	target := transition.Target
+	switch target.Type {
+	case "GOTO":
+		doc.Occurrences = append(doc.Occurrences, occurrence{Scope: scope, Name: target.Name, Role: roleTarget, Span: target.NameSpan})
+	case "CALL":
+		doc.Occurrences = append(doc.Occurrences, occurrence{Macro: true, Name: target.Name, Role: roleCallRef, Span: target.NameSpan})
+		if target.Return != "" {
+			doc.Occurrences = append(doc.Occurrences, occurrence{Scope: scope, Name: target.Return, Role: roleTarget, Span: target.ReturnSpan})
+		}
+		for _, exit := range target.Exits {
+			doc.Occurrences = append(doc.Occurrences, occurrence{Scope: scope, Name: exit.State, Role: roleTarget, Span: exit.StateSpan})
+		}
+	}
+}
+
+// occurrenceAt returns the identifier under pos, if any.
+func (doc *document) occurrenceAt(pos tmlang.Position) (occurrence, bool) {
+	for _, occ := range doc.Occurrences {
+		if occ.Span.Start.Line == pos.Line && occ.Span.Start.Column <= pos.Column && pos.Column <= occ.Span.End.Column {
+			return occ, true
+		}
+	}
+	return occurrence{}, false
+}
+
+func (doc *document) references(target occurrence) []occurrence {
+	var refs []occurrence
+	for _, occ := range doc.Occurrences {
+		if occ.sameSymbol(target) {
+			refs = append(refs, occ)
+		}
+	}
+	sortOccurrences(refs)
+	return refs
+}
+
+// definition picks where a symbol is defined: DEF for macros, none for one
+// defined elsewhere; for states the first line that has it as a source,
+// falling back to CONFIG or first use.
+func (doc *document) definition(target occurrence) (occurrence, bool) {
+	refs := doc.references(target)
+	if len(refs) == 0 {
+		return occurrence{}, false
+	}
+	if target.Macro {
+		for _, ref := range refs {
+			if ref.Role == roleDefine {
+				return ref, true
+			}
+		}
+		return occurrence{}, false
+	}
+	for _, role := range []string{roleDefine, roleSource, roleConfig} {
+		for _, ref := range refs {
+			if ref.Role == role {
+				return ref, true
+			}
+		}
+	}
+	return refs[0], true
+}
+
+// scopeAt returns the macro whose body contains line, or "" for MAIN.
+func (doc *document) scopeAt(line int) string {
+	ir := doc.Result.IR
+	mainStart, inMain := ir.Sections["MAIN:"]
+	if inMain && line >= mainStart.Start.Line {
+		return ""
+	}
+
+	scope, scopeLine := "", 0
+	for _, macro := range ir.Macros {
+		if macro.Span.Start.Line <= line && macro.Span.Start.Line > scopeLine {
+			scope, scopeLine = macro.Name, macro.Span.Start.Line
+		}
+	}
+	return scope
+}
+
+func sortOccurrences(occs []occurrence) {
+	sort.Slice(occs, func(i, j int) bool {
+		a, b := occs[i].Span.Start, occs[j].Span.Start
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+		return a.Column < b.Column
+	})
+}
+
+// toLSP converts a 1-based rune column position into LSP's 0-based UTF-16 form.
+func (doc *document) toLSP(pos tmlang.Position) Position {
+	line := max(pos.Line-1, 0)
+	if line >= len(doc.Lines) {
+		return Position{Line: line}
+	}
+
+	character := 0
+	for i, r := range []rune(doc.Lines[line]) {
+		if i >= pos.Column-1 {
+			break
+		}
+		character += utf16.RuneLen(r)
+	}
+	return Position{Line: line, Character: character}
+}
+
+func (doc *document) fromLSP(pos Position) tmlang.Position {
+	if pos.Line >= len(doc.Lines) {
+		return tmlang.Position{Line: pos.Line + 1, Column: 1}
+	}
+
+	column, units := 1, 0
+	for _, r := range doc.Lines[pos.Line] {
+		if units >= pos.Character {
+			break
+		}
+		units += utf16.RuneLen(r)
+		column++
+	}
+	return tmlang.Position{Line: pos.Line + 1, Column: column}
+}
+
+func (doc *document) toRange(span tmlang.Span) Range {
+	return Range{Start: doc.toLSP(span.Start), End: doc.toLSP(span.End)}
+}
+
+// linePrefix returns the text of the line before pos.
+func (doc *document) linePrefix(pos Position) string {
+	if pos.Line >= len(doc.Lines) {
+		return ""
+	}
+	line := doc.Lines[pos.Line]
+	units := 0
+	for i, r := range line {
+		if units >= pos.Character {
+			return line[:i]
+		}
+		units += utf16.RuneLen(r)
+	}
+	return line
+}
+
+// lineEnd is the position just past the last character of a 1-based line.
+func (doc *document) lineEnd(line int) tmlang.Position {
+	if line-1 >= len(doc.Lines) || line < 1 {
+		return tmlang.Position{Line: line, Column: 1}
+	}
+	text := strings.TrimRight(doc.Lines[line-1], "\r")
+	return tmlang.Position{Line: line, Column: utf8.RuneCountInString(text) + 1}
+}
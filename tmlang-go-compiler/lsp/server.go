@@ -0,0 +1,649 @@
+// Package lsp implements a Language Server Protocol server for TM-Lang
+// over stdio, built on the tmlang lexer, parser and analyzer.
+package lsp
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/textproto"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"tmlang-go-compiler/tmlang"
+)
+
+// Server holds the open documents of one editor session.
+type Server struct {
+	reader    *bufio.Reader
+	writer    io.Writer
+	documents map[string]*document
+	shutdown  bool
+}
+
+// Serve runs the server until the client sends exit or in is closed.
+func Serve(in io.Reader, out io.Writer) error {
+	server := &Server{
+		reader:    bufio.NewReader(in),
+		writer:    out,
+		documents: make(map[string]*document),
+	}
+
+	for {
+		body, err := server.readMessage()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		var req request
+		if err := json.Unmarshal(body, &req); err != nil {
+			continue // Not JSON-RPC; nothing sensible to reply to
+		}
+		if req.Method == "exit" {
+			if !server.shutdown {
+				return errors.New("exit without shutdown")
+			}
+			return nil
+		}
+
+		result, rpcErr := server.handle(req)
+		if req.ID == nil {
+			continue // Notifications get no response
+		}
+		if err := server.writeMessage(response{JSONRPC: "2.0", ID: req.ID, Result: result, Error: rpcErr}); err != nil {
+			return err
+		}
+	}
+}
+
+// readMessage reads one Content-Length framed message body.
+func (server *Server) readMessage() ([]byte, error) {
+	headers, err := textproto.NewReader(server.reader).ReadMIMEHeader()
+	if err != nil {
+		return nil, err
+	}
+	length, err := strconv.Atoi(headers.Get("Content-Length"))
+	if err != nil {
+		return nil, fmt.Errorf("bad Content-Length header: %w", err)
+	}
+
+	body := make([]byte, length)
+	_, err = io.ReadFull(server.reader, body)
+	return body, err
+}
+
+func (server *Server) writeMessage(message any) error {
+	body, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(server.writer, "Content-Length: %d\r\n\r\n%s", len(body), body)
+	return err
+}
+
+func (server *Server) notify(method string, params any) {
+	server.writeMessage(notification{JSONRPC: "2.0", Method: method, Params: params})
+}
+
+func (server *Server) handle(req request) (any, *responseError) {
+	switch req.Method {
+	case "initialize":
+		return map[string]any{
+			"capabilities": map[string]any{
+				"textDocumentSync":       1, // Full document on every change
+				"definitionProvider":     true,
+				"referencesProvider":     true,
+				"hoverProvider":          true,
+				"renameProvider":         true,
+				"documentSymbolProvider": true,
+				"completionProvider": map[string]any{
+					"triggerCharacters": []string{",", " ", ">", "."},
+				},
+			},
+			"serverInfo": map[string]string{"name": "tmlang"},
+		}, nil
+	case "initialized":
+		return nil, nil
+	case "shutdown":
+		server.shutdown = true
+		return nil, nil
+
+	case "textDocument/didOpen":
+		var params DidOpenParams
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return nil, invalidParams(err)
+		}
+		server.open(params.TextDocument.URI, params.TextDocument.Version, params.TextDocument.Text)
+		return nil, nil
+	case "textDocument/didChange":
+		var params DidChangeParams
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return nil, invalidParams(err)
+		}
+		if n := len(params.ContentChanges); n > 0 {
+			server.open(params.TextDocument.URI, params.TextDocument.Version, params.ContentChanges[n-1].Text)
+		}
+		return nil, nil
+	case "textDocument/didClose":
+		var params DidCloseParams
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return nil, invalidParams(err)
+		}
+		delete(server.documents, params.TextDocument.URI)
+		server.notify("textDocument/publishDiagnostics", PublishDiagnosticsParams{URI: params.TextDocument.URI, Diagnostics: []Diagnostic{}})
+		return nil, nil
+
+	case "textDocument/definition":
+		return withPosition(server, req, server.definition)
+	case "textDocument/hover":
+		return withPosition(server, req, server.hover)
+	case "textDocument/completion":
+		return withPosition(server, req, server.completion)
+	case "textDocument/references":
+		var params ReferenceParams
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return nil, invalidParams(err)
+		}
+		doc := server.documents[params.TextDocument.URI]
+		if doc == nil {
+			return nil, nil
+		}
+		return server.references(doc, params), nil
+	case "textDocument/rename":
+		var params RenameParams
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return nil, invalidParams(err)
+		}
+		doc := server.documents[params.TextDocument.URI]
+		if doc == nil {
+			return nil, nil
+		}
+		return server.rename(doc, params)
+	case "textDocument/documentSymbol":
+		var params DocumentSymbolParams
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return nil, invalidParams(err)
+		}
+		doc := server.documents[params.TextDocument.URI]
+		if doc == nil {
+			return nil, nil
+		}
+		return server.documentSymbols(doc), nil
+	}
+
+	if req.ID == nil || strings.HasPrefix(req.Method, "$/") {
+		return nil, nil // Unknown notifications are ignored
+	}
+	return nil, &responseError{Code: codeMethodNotFound, Message: "method not supported: " + req.Method}
+}
+
+func invalidParams(err error) *responseError {
+	return &responseError{Code: codeInvalidParams, Message: err.Error()}
+}
+
+// withPosition decodes TextDocumentPositionParams and calls handler with the document.
+func withPosition(server *Server, req request, handler func(*document, Position) any) (any, *responseError) {
+	var params TextDocumentPositionParams
+	if err := json.Unmarshal(req.Params, &params); err != nil {
+		return nil, invalidParams(err)
+	}
+	doc := server.documents[params.TextDocument.URI]
+	if doc == nil {
+		return nil, nil
+	}
+	return handler(doc, params.Position), nil
+}
+
+// open recompiles a document and publishes its diagnostics.
+func (server *Server) open(uri string, version int, text string) {
+	doc := newDocument(uri, version, text)
+	server.documents[uri] = doc
+
+	diagnostics := []Diagnostic{}
+	for _, d := range doc.Result.Diagnostics {
+		if d.Span.File != "" {
+			continue // Inside an IMPORTed file, summarized at its IMPORT line
+		}
+		diagnostic := Diagnostic{
+			Range:    doc.toRange(d.Span),
+			Severity: lspSeverity(d.Severity),
+			Code:     d.Code,
+			Source:   "tmlang",
+			Message:  d.Message,
+		}
+		if d.Fix != nil {
+			diagnostic.Message += " (" + d.Fix.Message + ")"
+		}
+		for _, related := range d.Related {
+			location := Location{URI: uri, Range: doc.toRange(related.Span)}
+			if related.Span.File != "" {
+				imported, ok := importedLocation(related.Span)
+				if !ok {
+					continue
+				}
+				location = imported
+			}
+			diagnostic.RelatedInformation = append(diagnostic.RelatedInformation, DiagnosticRelatedInformation{
+				Location: location,
+				Message:  related.Message,
+			})
+		}
+		diagnostics = append(diagnostics, diagnostic)
+	}
+
+	server.notify("textDocument/publishDiagnostics", PublishDiagnosticsParams{URI: uri, Version: version, Diagnostics: diagnostics})
+}
+
+func lspSeverity(severity tmlang.Severity) int {
+	switch severity {
+	case tmlang.SeverityWarning:
+		return severityWarning
+	case tmlang.SeverityInfo:
+		return severityInformation
+	}
+	return severityError
+}
+
+func (server *Server) definition(doc *document, pos Position) any {
+	occ, ok := doc.occurrenceAt(doc.fromLSP(pos))
+	if !ok {
+		return nil
+	}
+	if macro, exists := doc.Result.IR.Macros[occ.Name]; occ.Macro && exists && macro.Span.File != "" {
+		location, ok := importedLocation(macro.Span)
+		if !ok {
+			return nil
+		}
+		return location
+	}
+	def, ok := doc.definition(occ)
+	if !ok {
+		return nil
+	}
+	return Location{URI: doc.URI, Range: doc.toRange(def.Span)}
+}
+
+func (server *Server) references(doc *document, params ReferenceParams) []Location {
+	locations := []Location{}
+
+	occ, ok := doc.occurrenceAt(doc.fromLSP(params.Position))
+	if !ok {
+		return locations
+	}
+	def, _ := doc.definition(occ)
+
+	for _, ref := range doc.references(occ) {
+		if !params.Context.IncludeDeclaration && ref == def {
+			continue
+		}
+		locations = append(locations, Location{URI: doc.URI, Range: doc.toRange(ref.Span)})
+	}
+	return locations
+}
+
+// hover shows a state's outgoing transitions, or a macro's body.
+func (server *Server) hover(doc *document, pos Position) any {
+	occ, ok := doc.occurrenceAt(doc.fromLSP(pos))
+	if !ok {
+		return nil
+	}
+
+	var sb strings.Builder
+	sb.WriteString("```tmlang\n")
+
+	ir := doc.Result.IR
+	if occ.Macro {
+		macro, exists := ir.Macros[occ.Name]
+		if !exists {
+			return nil
+		}
+		header := macro.Name
+		if len(macro.Params) > 0 {
+			var params []string
+			for _, param := range macro.Params {
+				params = append(params, param.Name)
+			}
+			header += "(" + strings.Join(params, ", ") + ")"
+		}
+		fmt.Fprintf(&sb, "DEF %s:\n", header)
+		for _, transition := range macro.Body {
+			fmt.Fprintf(&sb, "    %s\n", formatTransition(transition))
+		}
+	} else {
+		body := ir.Main
+		if occ.Scope != "" {
+			body = ir.Macros[occ.Scope].Body
+		}
+
+		count := 0
+		for _, transition := range body {
+			if transition.Src == occ.Name {
+				sb.WriteString(formatTransition(transition) + "\n")
+				count++
+			}
+		}
+		if count == 0 {
+			sb.WriteString(occ.Name + " (no outgoing transitions)\n")
+		}
+	}
+	sb.WriteString("```")
+
+	if role := configRole(ir, occ); role != "" {
+		sb.WriteString("\n\n" + role)
+	}
+	if macro, exists := ir.Macros[occ.Name]; occ.Macro && exists && macro.Span.File != "" {
+		fmt.Fprintf(&sb, "\n\nDefined in %s:%d", macro.Span.File, macro.Span.Start.Line)
+	}
+
+	hoverRange := doc.toRange(occ.Span)
+	return Hover{Contents: MarkupContent{Kind: "markdown", Value: sb.String()}, Range: &hoverRange}
+}
+
+func configRole(ir tmlang.IntermediateRepresention, occ occurrence) string {
+	if occ.Macro || occ.Scope != "" {
+		return ""
+	}
+	switch occ.Name {
+	case ir.Meta.Start:
+		return "Start state"
+	case ir.Meta.Accept:
+		return "Accepting halt state"
+	case ir.Meta.Reject:
+		return "Rejecting halt state"
+	}
+	return ""
+}
+
+func formatTransition(transition tmlang.Transition) string {
+	target := transition.Target
+	next := target.Name
+	switch target.Type {
+	case "CALL":
+		name := target.Name
+		if target.Args != nil {
+			var args []string
+			for _, arg := range target.Args {
+				if arg.Type == "SYMBOL" {
+					args = append(args, tmlang.QuoteSymbol(arg.Value))
+				} else {
+					args = append(args, arg.Value)
+				}
+			}
+			name += "(" + strings.Join(args, ", ") + ")"
+		}
+		var exits []string
+		if target.Return != "" {
+			exits = append(exits, target.Return)
+		}
+		for _, exit := range target.Exits {
+			exits = append(exits, exit.Label+": "+exit.State)
+		}
+		next = fmt.Sprintf("CALL %s -> %s", name, strings.Join(exits, ", "))
+	case "RETURN":
+		next = strings.TrimSpace("RETURN " + target.Name)
+	}
+	return fmt.Sprintf("%s, %s -> %s, %s, %s", transition.Src, transition.ReadText(), transition.WriteText(), transition.Dir, next)
+}
+
+// completion offers names for the column of the transition being typed:
+// states, symbols, directions, or CALL/RETURN and macro names.
+func (server *Server) completion(doc *document, pos Position) any {
+	prefix := doc.linePrefix(pos)
+	trimmed := strings.TrimSpace(prefix)
+	scope := doc.scopeAt(pos.Line + 1)
+
+	items := []CompletionItem{}
+	addStates := func() {
+		for _, name := range doc.stateNames(scope) {
+			items = append(items, CompletionItem{Label: name, Kind: completionEnum, Detail: "state"})
+		}
+	}
+	addMacros := func() {
+		for _, name := range doc.macroNames() {
+			items = append(items, CompletionItem{Label: name, Kind: completionFunction, Detail: "macro"})
+		}
+	}
+
+	switch {
+	case strings.HasPrefix(trimmed, "DEF"), strings.HasSuffix(trimmed, ":") && !strings.Contains(trimmed, ","):
+		// Naming something new: nothing to offer
+	case strings.HasPrefix(trimmed, "START:"), strings.HasPrefix(trimmed, "ACCEPT:"), strings.HasPrefix(trimmed, "REJECT:"):
+		addStates()
+	case strings.HasPrefix(trimmed, "BLANK:"), strings.HasPrefix(trimmed, "INPUT:"), strings.HasPrefix(trimmed, "TAPE:"):
+		for _, symbol := range doc.symbols() {
+			items = append(items, CompletionItem{Label: symbol, Kind: completionValue, Detail: "tape symbol"})
+		}
+	case callPrefixPattern.MatchString(prefix):
+		addMacros()
+	case strings.Contains(prefix, "CALL"):
+		addStates() // Return state after CALL m ->
+	default:
+		arrow := strings.Contains(prefix, "->")
+		commas := strings.Count(symbolSetPattern.ReplaceAllString(prefix, "{}"), ",")
+		switch {
+		case commas == 0 && !arrow:
+			addStates()
+			for _, keyword := range []string{"DEF", "IMPORT", "CONFIG:", "MACROS:", "MAIN:", "TESTS:"} {
+				items = append(items, CompletionItem{Label: keyword, Kind: completionKeyword})
+			}
+		case commas == 1 && !arrow, commas == 1 && arrow:
+			for _, symbol := range doc.symbols() {
+				items = append(items, CompletionItem{Label: symbol, Kind: completionValue, Detail: "tape symbol"})
+			}
+			if arrow {
+				items = append(items, CompletionItem{Label: "=", Kind: completionKeyword, Detail: "write the symbol read"})
+			} else {
+				items = append(items, CompletionItem{Label: "*", Kind: completionKeyword, Detail: "any other symbol"})
+			}
+		case commas == 2:
+			for _, dir := range []string{"L", "R", "S"} {
+				items = append(items, CompletionItem{Label: dir, Kind: completionKeyword, Detail: "direction"})
+			}
+		default:
+			addStates()
+			items = append(items, CompletionItem{Label: "CALL", Kind: completionKeyword})
+			if scope != "" {
+				items = append(items, CompletionItem{Label: "RETURN", Kind: completionKeyword})
+			}
+		}
+	}
+	return items
+}
+
+func (doc *document) stateNames(scope string) []string {
+	seen := make(map[string]bool)
+	for _, occ := range doc.Occurrences {
+		if !occ.Macro && occ.Scope == scope && occ.Name != "" {
+			seen[occ.Name] = true
+		}
+	}
+	return sortedKeys(seen)
+}
+
+func (doc *document) macroNames() []string {
+	seen := make(map[string]bool)
+	for name := range doc.Result.IR.Macros {
+		seen[name] = true
+	}
+	return sortedKeys(seen)
+}
+
+// symbols lists the declared TAPE alphabet, and every tape symbol read or
+// written anywhere, plus the blank, in source form.
+func (doc *document) symbols() []string {
+	seen := map[string]bool{doc.Result.IR.Meta.BlankSymbol(): true}
+	add := func(body []tmlang.Transition) {
+		for _, transition := range body {
+			if transition.ReadType == "SYMBOL" && !transition.IsParam("READ", 0) {
+				seen[transition.Read] = true
+			}
+			for i, symbol := range transition.ReadSet {
+				if !transition.IsParam("SET", i) {
+					seen[symbol] = true
+				}
+			}
+			if !transition.WriteSame && !transition.IsParam("WRITE", 0) {
+				seen[transition.Write] = true
+			}
+			for _, arg := range transition.Target.Args {
+				if arg.Type == "SYMBOL" {
+					seen[arg.Value] = true
+				}
+			}
+		}
+	}
+	for _, symbol := range doc.Result.IR.Meta.TapeAlphabet {
+		seen[symbol] = true
+	}
+	add(doc.Result.IR.Main)
+	for _, macro := range doc.Result.IR.Macros {
+		add(macro.Body)
+	}
+	symbols := sortedKeys(seen)
+	for i, symbol := range symbols {
+		symbols[i] = tmlang.QuoteSymbol(symbol) // As written in source
+	}
+	return symbols
+}
+
+func sortedKeys(set map[string]bool) []string {
+	keys := make([]string, 0, len(set))
+	for key := range set {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+var (
+	identifierPattern = regexp.MustCompile(`^[a-zA-Z][a-zA-Z0-9_]+$`)
+	callPrefixPattern = regexp.MustCompile(`\bCALL\s+[\w.]*$`) // Cursor on a macro name
+	symbolSetPattern  = regexp.MustCompile(`\{[^}]*\}?`)       // Commas inside {0, 1} are not columns
+)
+
+func (server *Server) rename(doc *document, params RenameParams) (any, *responseError) {
+	occ, ok := doc.occurrenceAt(doc.fromLSP(params.Position))
+	if !ok {
+		return nil, &responseError{Code: codeRequestFailed, Message: "No state or macro at this position"}
+	}
+
+	newName := params.NewName
+	switch {
+	case !identifierPattern.MatchString(newName):
+		return nil, &responseError{Code: codeRequestFailed, Message: fmt.Sprintf("%q is not a valid name: use a letter followed by letters, digits or _", newName)}
+	case newName == "DEF" || newName == "CALL" || newName == "RETURN" || newName == "IMPORT" || newName == "AS":
+		return nil, &responseError{Code: codeRequestFailed, Message: fmt.Sprintf("%q is a reserved keyword", newName)}
+	case occ.Macro && strings.Contains(occ.Name, "."):
+		return nil, &responseError{Code: codeRequestFailed, Message: fmt.Sprintf("%s is defined in an imported file", occ.Name)}
+	}
+
+	for _, other := range doc.Occurrences {
+		if other.Name == newName && other.Macro == occ.Macro && other.Scope == occ.Scope {
+			return nil, &responseError{Code: codeRequestFailed, Message: fmt.Sprintf("%s is already in use", newName)}
+		}
+	}
+
+	edits := []TextEdit{}
+	for _, ref := range doc.references(occ) {
+		edits = append(edits, TextEdit{Range: doc.toRange(ref.Span), NewText: newName})
+	}
+	return WorkspaceEdit{Changes: map[string][]TextEdit{doc.URI: edits}}, nil
+}
+
+// documentSymbols outlines the MACROS section with one entry per DEF, the
+// MAIN section with one entry per source state, and the TESTS section with
+// one entry per case.
+func (server *Server) documentSymbols(doc *document) []DocumentSymbol {
+	ir := doc.Result.IR
+	symbols := []DocumentSymbol{}
+
+	if header, exists := ir.Sections["MACROS:"]; exists {
+		section := DocumentSymbol{Name: "MACROS", Kind: symbolNamespace, SelectionRange: doc.toRange(header)}
+		end := doc.lineEnd(header.Start.Line)
+
+		var names []string
+		for name, macro := range ir.Macros {
+			if macro.Span.File != "" {
+				continue // IMPORTed: defined in another file
+			}
+			names = append(names, name)
+		}
+		sort.Slice(names, func(i, j int) bool { return ir.Macros[names[i]].Span.Start.Line < ir.Macros[names[j]].Span.Start.Line })
+
+		for _, name := range names {
+			macro := ir.Macros[name]
+			macroEnd := doc.lineEnd(macro.Span.Start.Line)
+			if n := len(macro.Body); n > 0 {
+				macroEnd = macro.Body[n-1].Span.End
+			}
+			end = maxPosition(end, macroEnd)
+
+			section.Children = append(section.Children, DocumentSymbol{
+				Name:           macro.Name,
+				Detail:         fmt.Sprintf("%d transitions", len(macro.Body)),
+				Kind:           symbolFunction,
+				Range:          doc.toRange(tmlang.Span{Start: tmlang.Position{Line: macro.Span.Start.Line, Column: 1}, End: macroEnd}),
+				SelectionRange: doc.toRange(macro.Span),
+			})
+		}
+		section.Range = doc.toRange(tmlang.Span{Start: header.Start, End: end})
+		symbols = append(symbols, section)
+	}
+
+	if header, exists := ir.Sections["MAIN:"]; exists {
+		section := DocumentSymbol{Name: "MAIN", Kind: symbolNamespace, SelectionRange: doc.toRange(header)}
+		end := doc.lineEnd(header.Start.Line)
+
+		states := make(map[string]bool) // One entry per state, at its first line
+		for _, transition := range ir.Main {
+			end = maxPosition(end, transition.Span.End)
+
+			if states[transition.Src] {
+				continue
+			}
+			states[transition.Src] = true
+			section.Children = append(section.Children, DocumentSymbol{
+				Name:           transition.Src,
+				Kind:           symbolVariable,
+				Range:          doc.toRange(transition.Span),
+				SelectionRange: doc.toRange(transition.SrcSpan),
+			})
+		}
+		section.Range = doc.toRange(tmlang.Span{Start: header.Start, End: end})
+		symbols = append(symbols, section)
+	}
+
+	if header, exists := ir.Sections["TESTS:"]; exists {
+		section := DocumentSymbol{Name: "TESTS", Kind: symbolNamespace, SelectionRange: doc.toRange(header)}
+		end := doc.lineEnd(header.Start.Line)
+
+		for _, test := range ir.Tests {
+			end = maxPosition(end, test.Span.End)
+			section.Children = append(section.Children, DocumentSymbol{
+				Name:           test.String(),
+				Detail:         fmt.Sprintf("MAXSTEPS %d", test.MaxSteps),
+				Kind:           symbolEvent,
+				Range:          doc.toRange(test.Span),
+				SelectionRange: doc.toRange(test.Span),
+			})
+		}
+		section.Range = doc.toRange(tmlang.Span{Start: header.Start, End: end})
+		symbols = append(symbols, section)
+	}
+
+	return symbols
+}
+
+func maxPosition(a, b tmlang.Position) tmlang.Position {
+	if b.Line > a.Line || (b.Line == a.Line && b.Column > a.Column) {
+		return b
+	}
+	return a
+}
@@ -4,22 +4,82 @@
 package main
 
 import (
+	"encoding/json"
+	"flag"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"strings"
+
+	"tmlang-go-compiler/tmlang"
 )
 
+func printUsage() {
+	fmt.Println("Usage: tmlang [build] [flags] <file.tm>")
+	fmt.Println("       tmlang run [flags] <file.tm> [input]")
+	fmt.Println("       tmlang debug [flags] <file.tm> [--input <tape>]")
+	fmt.Println("       tmlang check [flags] <file.tm>...")
+	fmt.Println("       tmlang test [flags] <file.tm>...")
+	fmt.Println("       tmlang grade --suite <suite.tm> [flags] <submissions-dir>")
+	fmt.Println("       tmlang fmt [-w | -d | -l] [file.tm...]")
+	fmt.Println("       tmlang lsp")
+	fmt.Println("       tmlang dap")
+}
+
 func main() {
 
 	if len(os.Args) < 2 {
 		fmt.Println("Error: No input file provided.")
-		fmt.Println("Usage: tmlang <file.tm>")
+		printUsage()
 		os.Exit(1)
 	}
 
-	filepathArg := os.Args[1]
+	switch os.Args[1] {
+	case "run":
+		runCommand(os.Args[2:])
+	case "debug":
+		debugCommand(os.Args[2:])
+	case "check":
+		checkCommand(os.Args[2:])
+	case "test":
+		testCommand(os.Args[2:])
+	case "grade":
+		gradeCommand(os.Args[2:])
+	case "fmt":
+		fmtCommand(os.Args[2:])
+	case "lsp":
+		lspCommand(os.Args[2:])
+	case "dap":
+		dapCommand(os.Args[2:])
+	case "build":
+		buildCommand(os.Args[2:])
+	default:
+		buildCommand(os.Args[1:])
+	}
+}
+
+// buildCommand compiles a .tm file to C and DOT under ./build
+func buildCommand(args []string) {
+	flags := flag.NewFlagSet("build", flag.ExitOnError)
+	diagnosticsFormat := diagnosticsFlag(flags)
+	limits := limitsFlags(flags)
+	cMode := tmlang.CModeDefault
+	flags.Func("c-mode", "C emission `mode`: default (animated, --trace) or fast (table driven, summary at halt)", func(value string) error {
+		if value != tmlang.CModeDefault && value != tmlang.CModeFast {
+			return fmt.Errorf("unknown mode %q", value)
+		}
+		cMode = value
+		return nil
+	})
+	flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		printUsage()
+		os.Exit(1)
+	}
+	filepathArg := flags.Arg(0)
 
 	code, err := os.ReadFile(filepathArg)
 	if err != nil {
@@ -27,11 +87,17 @@ func main() {
 		os.Exit(1)
 	}
 
-	cCode, dotCode, err := Compile(string(code))
+	result, err := tmlang.Compile(string(code), tmlang.Options{EmitC: true, CMode: cMode, EmitDot: true, Limits: *limits, Path: filepathArg})
 	if err != nil {
-		fmt.Printf("Compilation Failed: %v\n", err)
+		if *diagnosticsFormat == "text" {
+			fmt.Println("Compilation Failed:")
+		}
+		reportDiagnostics(os.Stdout, *diagnosticsFormat, filepathArg, result.Diagnostics)
 		os.Exit(1)
 	}
+	if *diagnosticsFormat == "text" {
+		printDiagnostics(os.Stderr, filepathArg, result.Diagnostics) // Warnings only at this point
+	}
 
 	ext := filepath.Ext(filepathArg)
 	baseName := strings.TrimSuffix(filepath.Base(filepathArg), ext)
@@ -43,13 +109,13 @@ func main() {
 	}
 
 	cPath := filepath.Join(outputDir, baseName+".c")
-	if err := os.WriteFile(cPath, []byte(cCode), 0644); err != nil {
+	if err := os.WriteFile(cPath, []byte(result.C), 0644); err != nil {
 		fmt.Printf("Error writing C file: %v\n", err)
 		os.Exit(1)
 	}
 
 	dotPath := filepath.Join(outputDir, baseName+".dot")
-	if err := os.WriteFile(dotPath, []byte(dotCode), 0644); err != nil {
+	if err := os.WriteFile(dotPath, []byte(result.Dot), 0644); err != nil {
 		fmt.Printf("Error writing DOT file: %v\n", err)
 		os.Exit(1)
 	}
@@ -69,3 +135,81 @@ func main() {
 
 	fmt.Printf("\n Output saved to '%s/'\n", outputDir)
 }
+
+// diagnosticsFlag registers --diagnostics=text|json on a subcommand.
+func diagnosticsFlag(flags *flag.FlagSet) *string {
+	format := "text"
+	flags.Func("diagnostics", "diagnostics `format`: text or json (default text)", func(value string) error {
+		if value != "text" && value != "json" {
+			return fmt.Errorf("unknown format %q", value)
+		}
+		format = value
+		return nil
+	})
+	return &format
+}
+
+// limitsFlags registers the macro expansion limits on a subcommand.
+func limitsFlags(flags *flag.FlagSet) *tmlang.Limits {
+	var limits tmlang.Limits
+	flags.IntVar(&limits.MaxDepth, "max-depth", 0, "fail when CALLs nest more than `n` deep (default 32)")
+	flags.IntVar(&limits.MaxTransitions, "max-transitions", 0, "fail when expansion produces more than `n` rules (default 100000)")
+	return &limits
+}
+
+// reportDiagnostics writes diagnostics for one file in the chosen format.
+func reportDiagnostics(w io.Writer, format string, path string, diagnostics tmlang.Diagnostics) {
+	if format == "json" {
+		writeDiagnosticsJSON(w, withFile(path, diagnostics))
+		return
+	}
+	printDiagnostics(w, path, diagnostics)
+}
+
+func withFile(path string, diagnostics tmlang.Diagnostics) tmlang.Diagnostics {
+	tagged := make(tmlang.Diagnostics, len(diagnostics))
+	for i, d := range diagnostics {
+		if d.File == "" {
+			d.File = path
+		}
+		d.Related = append([]tmlang.Related(nil), d.Related...)
+		for j := range d.Related {
+			if d.Related[j].Span.File == "" {
+				d.Related[j].Span.File = path
+			}
+		}
+		tagged[i] = d
+	}
+	return tagged
+}
+
+func writeDiagnosticsJSON(w io.Writer, diagnostics tmlang.Diagnostics) {
+	if diagnostics == nil {
+		diagnostics = tmlang.Diagnostics{} // Always an array, never null
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	encoder.Encode(diagnostics)
+}
+
+// printDiagnostics writes each diagnostic as file:line:col: severity: message,
+// followed by its related notes and suggested fix.
+func printDiagnostics(w io.Writer, path string, diagnostics tmlang.Diagnostics) {
+	for _, d := range diagnostics {
+		file := path
+		if d.File != "" {
+			file = d.File
+		}
+		fmt.Fprintf(w, "%s:%s\n", file, d.Error())
+		for _, related := range d.Related {
+			relatedFile := path
+			if related.Span.File != "" {
+				relatedFile = related.Span.File
+			}
+			fmt.Fprintf(w, "    %s:%d:%d: note: %s\n", relatedFile, related.Span.Start.Line, related.Span.Start.Column, related.Message)
+		}
+		if d.Fix != nil {
+			fmt.Fprintf(w, "    fix: %s\n", d.Fix.Message)
+		}
+	}
+}
@@ -6,6 +6,8 @@ package main
 import (
 	"encoding/json"
 	"syscall/js"
+
+	"tmlang-go-compiler/tmlang"
 )
 
 // --- Structs for JSON Output ---
@@ -15,10 +17,18 @@ type CompileResponse struct {
 	CCode  string `json:"c_code"`
 	Dot    string `json:"dot"`
 	Error  string `json:"error"`
+
+	Diagnostics tmlang.Diagnostics `json:"diagnostics,omitempty"` // Every error and warning, when compilation failed
+}
+
+type FormatResponse struct {
+	Status    string `json:"status"` // "success" or "error"
+	Formatted string `json:"formatted"`
+	Error     string `json:"error"`
 }
 
 type SimulationResult struct {
-	Status  string           `json:"status"` // "ACCEPTED", "REJECTED", "TIMEOUT", "CRASH"
+	Status  string           `json:"status"` // "ACCEPTED", "REJECTED", "TIMEOUT", "CRASH", "OUT_OF_TAPE"
 	History []SimulationStep `json:"history"`
 }
 
@@ -35,21 +45,36 @@ func compileWrapper(this js.Value, args []js.Value) interface{} {
 		return errorJson("Missing source code")
 	}
 
-	cCode, dotCode, err := Compile(args[0].String())
+	result, err := tmlang.Compile(args[0].String(), tmlang.Options{EmitC: true, EmitDot: true})
 
 	if err != nil {
-		return errorJson(err.Error())
+		return diagnosticsJson(err, result.Diagnostics)
 	}
 
 	resp := CompileResponse{
 		Status: "success",
-		CCode:  cCode,
-		Dot:    dotCode,
+		CCode:  result.C,
+		Dot:    result.Dot,
 	}
 	b, _ := json.Marshal(resp)
 	return string(b)
 }
 
+// JS Usage: const result = JSON.parse(window.tmFormat(sourceCode));
+func formatWrapper(this js.Value, args []js.Value) interface{} {
+	if len(args) < 1 {
+		return errorJson("Missing source code")
+	}
+
+	formatted, err := tmlang.Format(args[0].String())
+	if err != nil {
+		return errorJson(err.Error())
+	}
+
+	b, _ := json.Marshal(FormatResponse{Status: "success", Formatted: formatted})
+	return string(b)
+}
+
 // JS Usage: const result = JSON.parse(window.tmRun(sourceCode, inputString));
 func runWrapper(this js.Value, args []js.Value) interface{} {
 	if len(args) < 2 {
@@ -59,116 +84,54 @@ func runWrapper(this js.Value, args []js.Value) interface{} {
 	sourceCode := args[0].String()
 	tapeInput := args[1].String()
 
-	// 1. Re-run Pipeline to get Logic (IR)
-	// We need the raw data structures (IR), not the C string.
-	var lexer Lexer
-	lexer.initLexer(sourceCode)
-
-	var parser Parser
-	parser.initParser(lexer.tokenizeSource())
-	ir, err := parser.parse()
+	// Compile resolves IMPORTs, std: libraries included, like the CLI does
+	compiled, err := tmlang.Compile(sourceCode, tmlang.Options{})
 	if err != nil {
-		return errorJson("Parse Error: " + err.Error())
+		return diagnosticsJson(err, compiled.Diagnostics)
 	}
 
-	var analyzer SemanticAnalyzer
-	analyzer.initSemanticAnalyzer(ir)
-	finalIR, err := analyzer.analyze()
-	if err != nil {
-		return errorJson("Semantic Error: " + err.Error())
+	if err := compiled.IR.Meta.ValidateInput(tapeInput); err != nil {
+		return errorJson("Input Error: " + err.Error())
 	}
 
-	// 2. Execute Simulation
-	// finalIR is the list of transitions, ir.Meta contains Start/Accept/Reject
-	result := runSimulationInternal(finalIR, ir.Meta, tapeInput, 5000)
+	result := runSimulationInternal(compiled.Transitions, compiled.IR.Meta, tapeInput, 5000)
 
 	b, _ := json.Marshal(result)
 	return string(b)
 }
 
-// This logic lives here because only the Web UI needs step-by-step history.
-func runSimulationInternal(transitions []FlatTransition, meta Meta, input string, maxSteps int) SimulationResult {
-	// 1. Setup Tape
-	const TAPE_SIZE = 20000
-	const HEAD_START = 10000
+// History recording lives here because only the Web UI needs step-by-step tape snapshots.
+func runSimulationInternal(transitions []tmlang.FlatTransition, meta tmlang.Meta, input string, maxSteps int) SimulationResult {
+	var sim tmlang.Simulator
+	sim.InitSimulator(transitions, meta, input)
 
-	tape := make([]rune, TAPE_SIZE)
-	for i := range tape {
-		tape[i] = '_'
-	}
-
-	// Load Input
-	for i, char := range input {
-		tape[HEAD_START+i] = char
-	}
-
-	head := HEAD_START
-	currentState := meta.Start
 	history := []SimulationStep{}
 
-	// 2. Execution Loop
 	for step := 0; step < maxSteps; step++ {
 
 		// DYNAMIC VIEWPORT:
-		// Calculate a window around the head so the user always sees the action.
-		// We show 15 chars to the left and 15 to the right.
-		viewStart := head - 15
-		viewEnd := head + 15
-
-		// Bounds safety checks
-		if viewStart < 0 {
-			viewStart = 0
-		}
-		if viewEnd > TAPE_SIZE {
-			viewEnd = TAPE_SIZE
-		}
-
-		tapeWindow := string(tape[viewStart:viewEnd])
+		// We show 15 chars to the left and 15 to the right of the head.
+		tapeWindow, head := sim.TapeWindow(15)
 
 		history = append(history, SimulationStep{
 			StepCount: step,
 			Tape:      tapeWindow,
-			Head:      head - viewStart, // The head index relative to the window string
-			State:     currentState,
+			Head:      head, // The head index relative to the window string
+			State:     sim.State,
 		})
 
 		// Check End Conditions
-		if currentState == meta.Accept {
-			return SimulationResult{Status: "ACCEPTED", History: history}
-		}
-		if currentState == meta.Reject {
-			return SimulationResult{Status: "REJECTED", History: history}
-		}
-
-		// Logic Lookup
-		var match *FlatTransition
-		charUnderHead := string(tape[head])
-
-		for _, t := range transitions {
-			if t.Src == currentState && t.Read == charUnderHead {
-				match = &t
-				break
-			}
+		if sim.Status != tmlang.StatusRunning {
+			return SimulationResult{Status: sim.Status, History: history}
 		}
 
-		if match == nil {
-			return SimulationResult{Status: "CRASH", History: history}
+		sim.Step()
+		if sim.Status == tmlang.StatusCrash {
+			return SimulationResult{Status: sim.Status, History: history}
 		}
-
-		if len(match.Write) > 0 {
-			tape[head] = rune(match.Write[0])
-		}
-
-		switch match.Dir {
-		case "R":
-			head++
-		case "L":
-			head--
-		}
-		currentState = match.Next
 	}
 
-	return SimulationResult{Status: "TIMEOUT", History: history}
+	return SimulationResult{Status: tmlang.StatusTimeout, History: history}
 }
 
 func errorJson(msg string) string {
@@ -176,11 +139,19 @@ func errorJson(msg string) string {
 	return string(b)
 }
 
+// diagnosticsJson reports a failed compilation with its diagnostics, so the
+// editor can mark them, lexer errors included.
+func diagnosticsJson(err error, diagnostics tmlang.Diagnostics) string {
+	b, _ := json.Marshal(CompileResponse{Status: "error", Error: err.Error(), Diagnostics: diagnostics})
+	return string(b)
+}
+
 func main() {
 	c := make(chan struct{})
 
 	js.Global().Set("tmCompile", js.FuncOf(compileWrapper))
 	js.Global().Set("tmRun", js.FuncOf(runWrapper))
+	js.Global().Set("tmFormat", js.FuncOf(formatWrapper))
 
 	<-c
 }
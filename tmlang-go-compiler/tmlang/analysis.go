@@ -0,0 +1,194 @@
+package tmlang
+
+import (
+	"sort"
+	"strings"
+)
+
+// MissingRule is a (state, symbol) pair with no transition; the machine
+// would CRASH if it ever read Symbol in State.
+type MissingRule struct {
+	State  string `json:"state"`
+	Symbol string `json:"symbol"`
+}
+
+// AnalysisReport describes the state graph of a flattened machine.
+type AnalysisReport struct {
+	States         []string      `json:"states"`
+	Alphabet       []string      `json:"alphabet"`
+	AlphabetSource string        `json:"alphabet_source"` // "inferred" or "declared"
+	Unreachable    []string      `json:"unreachable"`     // Not reachable from START
+	Dead           []string      `json:"dead"`            // Reachable, but can never reach ACCEPT or REJECT
+	HaltingRules   []string      `json:"halting_rules"`   // ACCEPT/REJECT states that have rules
+	Missing        []MissingRule `json:"missing"`         // Pairs with no rule, over Alphabet
+}
+
+// AnalyzeMachine builds the reachability report for transitions. The
+// alphabet is the declared TAPE alphabet, or when there is none it is
+// inferred from INPUT and every symbol read or written; both include the
+// blank.
+func AnalyzeMachine(meta Meta, transitions []FlatTransition) AnalysisReport {
+	var alphabet []string
+	if len(meta.TapeAlphabet) > 0 {
+		alphabet = withBlank(meta.TapeAlphabet, meta.BlankSymbol())
+	}
+
+	report := AnalysisReport{
+		AlphabetSource: "declared",
+		Unreachable:    []string{},
+		Dead:           []string{},
+		HaltingRules:   []string{},
+		Missing:        []MissingRule{},
+	}
+	if len(alphabet) == 0 {
+		report.AlphabetSource = "inferred"
+		alphabet = inferAlphabet(meta, transitions)
+	}
+	report.Alphabet = alphabet
+
+	edges := make(map[string][]string)   // State -> next states
+	reverse := make(map[string][]string) // State -> states that lead to it
+	rules := make(map[string]map[string]bool)
+	stateSet := map[string]bool{meta.Start: true, meta.Accept: true, meta.Reject: true}
+
+	for _, t := range transitions {
+		stateSet[t.Src] = true
+		stateSet[t.Next] = true
+		edges[t.Src] = append(edges[t.Src], t.Next)
+		reverse[t.Next] = append(reverse[t.Next], t.Src)
+		if rules[t.Src] == nil {
+			rules[t.Src] = make(map[string]bool)
+		}
+		rules[t.Src][t.Read] = true
+	}
+	delete(stateSet, "")
+
+	for state := range stateSet {
+		report.States = append(report.States, state)
+	}
+	sort.Strings(report.States)
+
+	halting := func(state string) bool { return state == meta.Accept || state == meta.Reject }
+
+	reachable := walkStates([]string{meta.Start}, edges)
+	canHalt := walkStates([]string{meta.Accept, meta.Reject}, reverse)
+
+	for _, state := range report.States {
+		switch {
+		case !reachable[state]:
+			if state != meta.Reject { // Machines often never reject explicitly
+				report.Unreachable = append(report.Unreachable, state)
+			}
+		case !canHalt[state]:
+			report.Dead = append(report.Dead, state)
+		}
+
+		if halting(state) {
+			if len(rules[state]) > 0 {
+				report.HaltingRules = append(report.HaltingRules, state)
+			}
+			continue
+		}
+		for _, symbol := range alphabet {
+			if !rules[state][symbol] {
+				report.Missing = append(report.Missing, MissingRule{state, symbol})
+			}
+		}
+	}
+
+	return report
+}
+
+// walkStates returns every state reachable from roots along edges.
+func walkStates(roots []string, edges map[string][]string) map[string]bool {
+	seen := make(map[string]bool)
+	queue := append([]string{}, roots...)
+	for _, root := range roots {
+		seen[root] = true
+	}
+	for len(queue) > 0 {
+		state := queue[0]
+		queue = queue[1:]
+		for _, next := range edges[state] {
+			if !seen[next] {
+				seen[next] = true
+				queue = append(queue, next)
+			}
+		}
+	}
+	return seen
+}
+
+func inferAlphabet(meta Meta, transitions []FlatTransition) []string {
+	symbols := append([]string{}, meta.InputAlphabet...)
+	for _, t := range transitions {
+		symbols = append(symbols, t.Read, t.Write)
+	}
+	return withBlank(symbols, meta.BlankSymbol())
+}
+
+// withBlank returns the sorted, de-duplicated symbols plus the blank.
+func withBlank(symbols []string, blank string) []string {
+	set := map[string]bool{blank: true}
+	for _, symbol := range symbols {
+		set[symbol] = true
+	}
+
+	alphabet := make([]string, 0, len(set))
+	for symbol := range set {
+		alphabet = append(alphabet, symbol)
+	}
+	sort.Strings(alphabet)
+	return alphabet
+}
+
+// Diagnostics turns the report into warnings located at each state's first
+// rule, or the first rule that leads to it.
+func (report AnalysisReport) Diagnostics(transitions []FlatTransition) Diagnostics {
+	var diagnostics Diagnostics
+
+	locate := func(state string) (Span, []Related) {
+		for _, t := range transitions {
+			if t.Src == state {
+				return t.Span, callChain(t.Calls)
+			}
+		}
+		for _, t := range transitions {
+			if t.Next == state {
+				return t.Span, callChain(t.Calls)
+			}
+		}
+		return Span{}, nil
+	}
+	add := func(code string, state string, format string, args ...any) {
+		span, related := locate(state)
+		diagnostic := newWarning(code, span, format, args...)
+		diagnostic.Related = related
+		diagnostics = append(diagnostics, diagnostic)
+	}
+
+	for _, state := range report.Unreachable {
+		add(CodeUnreachableState, state, "State %s is unreachable from START", state)
+	}
+	for _, state := range report.Dead {
+		add(CodeDeadState, state, "State %s can never reach ACCEPT or REJECT", state)
+	}
+	for _, state := range report.HaltingRules {
+		add(CodeRuleOnHaltingState, state, "State %s halts the machine, so its rules are never used", state)
+	}
+
+	missingByState := make(map[string][]string)
+	var order []string
+	for _, missing := range report.Missing {
+		if missingByState[missing.State] == nil {
+			order = append(order, missing.State)
+		}
+		missingByState[missing.State] = append(missingByState[missing.State], QuoteSymbol(missing.Symbol))
+	}
+	for _, state := range order {
+		add(CodeMissingTransition, state, "State %s has no rule for %s (the machine crashes there)", state, strings.Join(missingByState[state], ", "))
+	}
+
+	diagnostics.Sort()
+	return diagnostics
+}
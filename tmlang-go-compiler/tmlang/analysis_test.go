@@ -0,0 +1,27 @@
+package tmlang
+
+import "testing"
+
+// With INPUT but no TAPE, an INPUT symbol that no rule reads is still part
+// of the alphabet, so the state that would crash on it is reported.
+func TestAnalyzeInputWithoutTape(t *testing.T) {
+	source := "CONFIG:\n    START: q0\n    ACCEPT: qa\n    REJECT: qr\n    INPUT: 0, 1, 2\nMAIN:\n    q0, 0 -> 0, R, q0\n    q0, 1 -> 1, R, q0\n    q0, _ -> _, S, qa\n"
+	result, err := Compile(source, Options{Analyze: true})
+	if err != nil {
+		t.Fatalf("compile failed:\n%v", err)
+	}
+
+	report := result.Analysis
+	if report.AlphabetSource != "inferred" {
+		t.Errorf("alphabet source = %s, want inferred", report.AlphabetSource)
+	}
+	found := false
+	for _, missing := range report.Missing {
+		if missing == (MissingRule{State: "q0", Symbol: "2"}) {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("missing = %v, want (q0, 2) among them", report.Missing)
+	}
+}
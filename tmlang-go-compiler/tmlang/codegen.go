@@ -0,0 +1,514 @@
+package tmlang
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// CodeGenerator emits backend output from a flattened transition table.
+type CodeGenerator struct {
+	Meta    Meta
+	FinalIR []FlatTransition
+	File    string // Source path, for #line directives; "" leaves them out
+}
+
+func (cg *CodeGenerator) InitCodegen(meta Meta, finalIR []FlatTransition) {
+	cg.Meta = meta
+	cg.FinalIR = finalIR
+}
+
+// GenerateC returns a standalone C program that simulates the machine.
+func (cg *CodeGenerator) GenerateC() string {
+
+	stateList, stateMap := cg.stateIDs()
+	stateComments := ""
+	for i, name := range stateList {
+		stateComments += fmt.Sprintf("// %s: %d\n", name, i)
+	}
+
+	startID := stateMap[cg.Meta.Start]
+	acceptID := stateMap[cg.Meta.Accept]
+	rejectID := stateMap[cg.Meta.Reject]
+
+	// Group transitions by Source State ID
+	grouped := make(map[int][]FlatTransition)
+	for _, t := range cg.FinalIR {
+		srcID := stateMap[t.Src]
+		grouped[srcID] = append(grouped[srcID], t)
+	}
+
+	// Build switch-case logic. Each case names the state's origin, and with a
+	// known source file each rule gets a #line pointing at the line it came from.
+	switchLogic := ""
+	sourceMap := NewSourceMap(cg.FinalIR)
+
+	for i := 0; i < len(stateList); i++ {
+		rules, exists := grouped[i]
+		if !exists {
+			continue
+		}
+
+		origin := strings.ReplaceAll(sourceMap.Describe(stateList[i], cg.File), "*/", "* /")
+		switchLogic += fmt.Sprintf("            case %d: /* %s: %s */\n", i, stateList[i], origin)
+
+		for j, rule := range rules {
+			prefix := "else if"
+			if j == 0 {
+				prefix = "if"
+			}
+
+			move := moveOf(rule.Dir)
+			nextID := stateMap[rule.Next]
+
+			if cg.File != "" {
+				file := rule.Span.File
+				if file == "" {
+					file = cg.File
+				}
+				switchLogic += fmt.Sprintf("#line %d %s\n", rule.Span.Start.Line, strconv.Quote(file))
+			}
+			switchLogic += fmt.Sprintf("                %s (read_val == %s) { step(%s, %d, %d); matched = 1; }\n",
+				prefix, cSymbol(rule.Read), cSymbol(rule.Write), move, nextID)
+		}
+		if cg.File != "" {
+			switchLogic += lineReset + "\n"
+		}
+		switchLogic += "                break;\n"
+	}
+
+	// Reject input outside the declared INPUT alphabet, or TAPE without one
+	inputCheck := ""
+	if inputSymbols := cg.Meta.InputSymbols(); inputSymbols != nil {
+		var literals []string
+		for _, symbol := range inputSymbols {
+			literals = append(literals, cSymbol(symbol))
+		}
+		inputCheck = fmt.Sprintf(`
+				static const int input_alphabet[] = { %s };
+				int valid = 0;
+				for(int k=0; k<%d; k++) {
+					if (input_alphabet[k] == symbol) valid = 1;
+				}
+				if (!valid) {
+					fprintf(stderr, "Invalid input symbol '");
+					put_symbol(stderr, symbol);
+					fprintf(stderr, "'\n");
+					return EXIT_USAGE;
+				}`, strings.Join(literals, ", "), len(literals))
+	}
+
+	stateNames := make([]string, len(stateList))
+	for i, name := range stateList {
+		stateNames[i] = strconv.Quote(name)
+	}
+
+	// Final C Code
+	cCode := fmt.Sprintf(`#include <stdio.h>
+		#include <stdlib.h>
+		#include <string.h>
+
+		#define BLANK %s
+		#define TAPE_CHUNK 1024
+
+		/* Exit codes, the same as tmlang run */
+		#define EXIT_ACCEPTED 0
+		#define EXIT_REJECTED 1
+		#define EXIT_CRASH 2
+		#define EXIT_TIMEOUT 3
+		#define EXIT_USAGE 4
+		#define EXIT_OUT_OF_TAPE 5
+
+		/* Compile with -DMAX_CELLS=n, or run with --max-cells n, to halt with
+		   OUT_OF_TAPE rather than use more than n cells */
+		#ifndef MAX_CELLS
+		#define MAX_CELLS 0
+		#endif
+
+		/* --- STATE MAP --- 
+		%s*/
+
+		static const char *state_names[] = { %s };
+
+		int START_STATE = %d;
+		int ACCEPT_STATE = %d;
+		int REJECT_STATE = %d;
+
+		/* Set from the command line */
+		int quiet = 0;       /* --quiet: no output beyond what other flags ask for */
+		int trace = 0;       /* --trace: one line per step */
+		int print_final = 0; /* --print-tape: the tape and head after halting */
+		int animate = 1;     /* Redraw the tape in place each step, unless --quiet or --trace */
+		long max_steps = 0;  /* --max-steps: TIMEOUT after this many steps, 0 for no limit */
+		long max_cells = MAX_CELLS;
+
+		/* Cells hold Unicode code points so symbols like α fit in one cell. The
+		   tape grows in either direction on demand; head and low/high are
+		   positions relative to the first input cell, which is tape[origin]. */
+		int *tape = NULL;
+		int tape_size = 0;
+		int origin = 0;
+		int head = 0;
+		int low = 0, high = 0; /* Leftmost and rightmost positions used */
+		int current_state;
+		long steps = 0;
+
+		%s
+		int cell(int pos) {
+			int i = origin + pos;
+			return i < 0 || i >= tape_size ? BLANK : tape[i];
+		}
+
+		/* Grows the tape to reach pos, at least doubling it each time */
+		void reach(int pos) {
+			int i = origin + pos;
+			if (i >= 0 && i < tape_size) return;
+			int grow = tape_size > TAPE_CHUNK ? tape_size : TAPE_CHUNK;
+			if (i < 0 && -i > grow) grow = -i;
+			if (i >= tape_size && i - tape_size + 1 > grow) grow = i - tape_size + 1;
+			int *grown = allocate(NULL, (tape_size + grow) * sizeof(int));
+			int shift = i < 0 ? grow : 0; /* Old cells move right when growing left */
+			for(int k = 0; k < tape_size + grow; k++) grown[k] = BLANK;
+			if (tape_size > 0) memcpy(grown + shift, tape, tape_size * sizeof(int));
+			free(tape);
+			tape = grown;
+			tape_size += grow;
+			origin += shift;
+		}
+
+		void set_cell(int pos, int symbol) {
+			reach(pos);
+			tape[origin + pos] = symbol;
+		}
+
+		void draw_tape() {
+			printf("\r[ ");
+			for(int i = head - 10; i <= head + 10; i++) {
+				if(i == head) { printf("["); put_symbol(stdout, cell(i)); printf("]"); }
+				else { printf(" "); put_symbol(stdout, cell(i)); printf(" "); }
+			}
+			printf(" ] State: %%s  ", state_names[current_state]);
+			fflush(stdout); 
+		}
+
+		/* Prints the tape without leading and trailing blanks, and the head's
+		   offset from its first cell, like tmlang run */
+		void print_tape() {
+			int first = low, last = high;
+			while (first <= last && cell(first) == BLANK) first++;
+			while (last >= first && cell(last) == BLANK) last--;
+			printf("Tape:   ");
+			for(int i = first; i <= last; i++) put_symbol(stdout, cell(i));
+			printf("\nHead:   %%d\n", first <= last ? head - first : 0);
+		}
+
+		void halt(const char *status, int code) {
+			if (animate) printf("\n\n%%s!\n", status);
+			else if (!quiet) printf("Status: %%s\n", status);
+			if (print_final) print_tape();
+			exit(code);
+		}
+
+		/* Applies one rule: write, move by -1, 0 or 1, and go to next */
+		void step(int write, int move, int next) {
+			int pos = head + move;
+			int new_low = pos < low ? pos : low;
+			int new_high = pos > high ? pos : high;
+			if (max_cells > 0 && new_high - new_low + 1 > max_cells) {
+				if (animate) printf("\n");
+				fprintf(stderr, "OUT OF TAPE: the machine needs more than %%ld cells\n", max_cells);
+				halt("OUT_OF_TAPE", EXIT_OUT_OF_TAPE);
+			}
+			set_cell(head, write);
+			head = pos;
+			low = new_low;
+			high = new_high;
+			current_state = next;
+		}
+
+		int usage(const char *program) {
+			fprintf(stderr, "Usage: %%s [--quiet] [--trace] [--print-tape] [--max-steps n] [--max-cells n] [input]\n", program);
+			fprintf(stderr, "Input is taken from the argument, or else from stdin.\n");
+			return EXIT_USAGE;
+		}
+
+		int main(int argc, char **argv) {
+			const char *input = NULL;
+			int flags_done = 0;
+			for(int i = 1; i < argc; i++) {
+				const char *arg = argv[i];
+				if (flags_done || strncmp(arg, "--", 2) != 0) {
+					if (input != NULL) return usage(argv[0]);
+					input = arg;
+				} else if (strcmp(arg, "--") == 0) {
+					flags_done = 1;
+				} else if (strcmp(arg, "--quiet") == 0) {
+					quiet = 1;
+				} else if (strcmp(arg, "--trace") == 0) {
+					trace = 1;
+				} else if (strcmp(arg, "--print-tape") == 0) {
+					print_final = 1;
+				} else if (strcmp(arg, "--max-steps") == 0 && i + 1 < argc) {
+					if ((max_steps = parse_count(argv[++i])) < 0) return usage(argv[0]);
+				} else if (strcmp(arg, "--max-cells") == 0 && i + 1 < argc) {
+					if ((max_cells = parse_count(argv[++i])) < 0) return usage(argv[0]);
+				} else if (strcmp(arg, "--help") == 0) {
+					usage(argv[0]);
+					return 0;
+				} else {
+					return usage(argv[0]);
+				}
+			}
+			animate = !quiet && !trace;
+
+			if (input == NULL) {
+				if (animate) { printf("Enter Input: "); fflush(stdout); }
+				input = read_all(stdin);
+			}
+
+			current_state = START_STATE;
+			reach(0);
+			int pos = 0;
+			for(int i=0; input[i] != '\0'; ) {
+				int symbol;
+				i += decode_symbol(input + i, &symbol);%s
+				set_cell(pos++, symbol);
+			}
+			high = pos > 0 ? pos - 1 : 0;
+
+			if (animate) printf("\n--- RUNNING ---\n");
+
+			while(1) {
+				if (animate) draw_tape();
+
+				if (current_state == ACCEPT_STATE) halt("ACCEPTED", EXIT_ACCEPTED);
+				if (current_state == REJECT_STATE) halt("REJECTED", EXIT_REJECTED);
+				if (max_steps > 0 && steps >= max_steps) halt("TIMEOUT", EXIT_TIMEOUT);
+
+				int read_val = cell(head);
+				int matched = 0;
+				if (trace) {
+					printf("%%ld\t%%s\t%%d\t", steps, state_names[current_state], head);
+					put_symbol(stdout, read_val);
+					printf("\n");
+				}
+
+				switch(current_state) {
+						%s
+				}
+				
+				if (!matched) {
+					if (animate) printf("\n");
+					fflush(stdout);
+					fprintf(stderr, "CRASH: State %%s has no rule for char '", state_names[current_state]);
+					put_symbol(stderr, read_val);
+					fprintf(stderr, "'\n");
+					halt("CRASH", EXIT_CRASH);
+				}
+				steps++;
+			}
+		}
+	`, cSymbol(cg.Meta.BlankSymbol()), stateComments, strings.Join(stateNames, ", "), startID, acceptID, rejectID, cRuntime, inputCheck, switchLogic)
+
+	return cg.resetLines(cCode)
+}
+
+// stateIDs numbers every state, sorted by name, for the C backends.
+func (cg *CodeGenerator) stateIDs() ([]string, map[string]int) {
+	stateSet := make(map[string]bool)
+	stateSet[cg.Meta.Start] = true
+	stateSet[cg.Meta.Accept] = true
+	stateSet[cg.Meta.Reject] = true
+
+	for _, t := range cg.FinalIR {
+		stateSet[t.Src] = true
+		stateSet[t.Next] = true
+	}
+
+	var stateList []string
+	for name := range stateSet {
+		stateList = append(stateList, name)
+	}
+	sort.Strings(stateList)
+
+	stateMap := make(map[string]int)
+	for i, name := range stateList {
+		stateMap[name] = i
+	}
+	return stateList, stateMap
+}
+
+// moveOf returns the head movement of a direction: -1, 0 or 1.
+func moveOf(dir string) int {
+	switch dir {
+	case "R":
+		return 1
+	case "L":
+		return -1
+	}
+	return 0
+}
+
+// cRuntime holds the helpers shared by both C emitters: UTF-8 input and
+// output, checked allocation, reading stdin and parsing flag values.
+const cRuntime = `/* Reads one UTF-8 character from s into *symbol, returns its length in bytes */
+		int decode_symbol(const char *s, int *symbol) {
+			unsigned char c = s[0];
+			int length = c < 0x80 ? 1 : c < 0xE0 ? 2 : c < 0xF0 ? 3 : 4;
+			*symbol = length == 1 ? c : c & (0x7F >> length);
+			for(int i = 1; i < length; i++) {
+				if ((s[i] & 0xC0) != 0x80) return i; /* Truncated sequence */
+				*symbol = (*symbol << 6) | (s[i] & 0x3F);
+			}
+			return length;
+		}
+
+		void put_symbol(FILE *out, int symbol) {
+			if (symbol < 0x80) {
+				fputc(symbol, out);
+			} else if (symbol < 0x800) {
+				fputc(0xC0 | (symbol >> 6), out);
+				fputc(0x80 | (symbol & 0x3F), out);
+			} else if (symbol < 0x10000) {
+				fputc(0xE0 | (symbol >> 12), out);
+				fputc(0x80 | ((symbol >> 6) & 0x3F), out);
+				fputc(0x80 | (symbol & 0x3F), out);
+			} else {
+				fputc(0xF0 | (symbol >> 18), out);
+				fputc(0x80 | ((symbol >> 12) & 0x3F), out);
+				fputc(0x80 | ((symbol >> 6) & 0x3F), out);
+				fputc(0x80 | (symbol & 0x3F), out);
+			}
+		}
+
+		void *allocate(void *old, size_t size) {
+			void *memory = realloc(old, size);
+			if (memory == NULL) {
+				fprintf(stderr, "Out of memory\n");
+				exit(EXIT_USAGE);
+			}
+			return memory;
+		}
+
+		/* Reads all of in, without the trailing line break */
+		char *read_all(FILE *in) {
+			size_t size = 0, capacity = 256;
+			char *text = allocate(NULL, capacity);
+			int c;
+			while ((c = fgetc(in)) != EOF) {
+				if (size + 1 >= capacity) text = allocate(text, capacity *= 2);
+				text[size++] = c;
+			}
+			while (size > 0 && (text[size - 1] == '\n' || text[size - 1] == '\r')) size--;
+			text[size] = '\0';
+			return text;
+		}
+
+		/* Parses a non-negative count, or returns -1 */
+		long long parse_count(const char *text) {
+			char *end;
+			long long value = strtoll(text, &end, 10);
+			return *text == '\0' || *end != '\0' || value < 0 ? -1 : value;
+		}
+`
+
+// lineReset marks where the generated code resumes after rules mapped to
+// the source with #line; resetLines numbers it.
+const lineReset = "#line RESET"
+
+// resetLines points the code after each lineReset back at the C file
+// itself, named after the source like the CLI saves it.
+func (cg *CodeGenerator) resetLines(cCode string) string {
+	if cg.File == "" {
+		return cCode
+	}
+	cFile := strings.TrimSuffix(filepath.Base(cg.File), filepath.Ext(cg.File)) + ".c"
+	lines := strings.Split(cCode, "\n")
+	for i, line := range lines {
+		if line == lineReset {
+			lines[i] = fmt.Sprintf("#line %d %s", i+2, strconv.Quote(cFile)) // The next line is i+2, 1-based
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// cSymbol returns a C int literal for a tape symbol: a character constant
+// for printable ASCII, otherwise the code point.
+func cSymbol(symbol string) string {
+	char := []rune(symbol)[0]
+	switch {
+	case char == '\'' || char == '\\':
+		return `'\` + string(char) + `'`
+	case char >= ' ' && char <= '~':
+		return "'" + string(char) + "'"
+	}
+	return fmt.Sprintf("0x%X /* %c */", char, char)
+}
+
+// GenerateDot returns the state diagram in GraphViz DOT format.
+func (cg *CodeGenerator) GenerateDot() string {
+	var sb strings.Builder
+
+	sb.WriteString("digraph TuringMachine {\n")
+	sb.WriteString("    rankdir=LR;\n")
+	sb.WriteString("    node [shape = circle];\n")
+
+	// 1. Special Shapes
+	sb.WriteString(fmt.Sprintf("    \"%s\" [shape = doublecircle, color=green];\n", cg.Meta.Accept))
+	sb.WriteString(fmt.Sprintf("    \"%s\" [shape = doublecircle, color=red];\n", cg.Meta.Reject))
+
+	// Tooltips show where each state was written, through which CALLs
+	sourceMap := NewSourceMap(cg.FinalIR)
+	var states []string
+	for state := range sourceMap {
+		states = append(states, state)
+	}
+	sort.Strings(states)
+	for _, state := range states {
+		sb.WriteString(fmt.Sprintf("    \"%s\" [tooltip = \"%s\"];\n", state, dotEscape(sourceMap.Describe(state, cg.File))))
+	}
+
+	// 2. Entry Point
+	sb.WriteString("    entry [shape = point];\n")
+	sb.WriteString(fmt.Sprintf("    entry -> \"%s\";\n", cg.Meta.Start))
+
+	// 3. Group Transitions (Edge Merging)
+	type EdgeKey struct {
+		Src, Dst string
+	}
+	edges := make(map[EdgeKey][]string)
+	blank := cg.Meta.BlankSymbol()
+
+	for _, t := range cg.FinalIR {
+		key := EdgeKey{Src: t.Src, Dst: t.Next}
+
+		// Clean Labels for Diagram (Replace the blank symbol with 'BLANK')
+		rLbl := t.Read
+		if rLbl == blank {
+			rLbl = "BLANK"
+		}
+		wLbl := t.Write
+		if wLbl == blank {
+			wLbl = "BLANK"
+		}
+
+		label := fmt.Sprintf("%s / %s, %s", dotEscape(rLbl), dotEscape(wLbl), t.Dir)
+		edges[key] = append(edges[key], label)
+	}
+
+	// 4. Generate Merged Edges
+	for key, labels := range edges {
+		combinedLabel := strings.Join(labels, "\\n")
+		sb.WriteString(fmt.Sprintf("    \"%s\" -> \"%s\" [label = \"%s\"];\n", key.Src, key.Dst, combinedLabel))
+	}
+
+	sb.WriteString("}\n")
+	return sb.String()
+}
+
+// dotEscape makes text safe inside a double-quoted DOT string.
+func dotEscape(text string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(text)
+}
@@ -0,0 +1,333 @@
+package tmlang
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// C emission modes, selected by Options.CMode.
+const (
+	CModeDefault = "default" // GenerateC: animated, with --trace and #line mapping
+	CModeFast    = "fast"    // GenerateFastC: table driven, silent until the machine halts
+)
+
+// GenerateFastC returns a standalone C program that runs the machine as fast
+// as it can: symbols are numbered, every (state, symbol) pair is looked up in
+// a dense table, and nothing is printed until the machine halts.
+func (cg *CodeGenerator) GenerateFastC() string {
+	stateList, stateMap := cg.stateIDs()
+	symbolList, symbolMap := cg.symbolIDs()
+	sourceMap := NewSourceMap(cg.FinalIR)
+
+	// One row per state, one {next, write, move} entry per symbol. Halting
+	// states keep empty rows, so the loop needs a single check to stop.
+	rows := make([][]string, len(stateList))
+	for i := range rows {
+		rows[i] = make([]string, len(symbolList))
+		for j := range rows[i] {
+			rows[i][j] = "NO_RULE"
+		}
+	}
+	for _, t := range cg.FinalIR {
+		if t.Src == cg.Meta.Accept || t.Src == cg.Meta.Reject {
+			continue
+		}
+		rows[stateMap[t.Src]][symbolMap[t.Read]] = fmt.Sprintf("{%d, %d, %d}", stateMap[t.Next], symbolMap[t.Write], moveOf(t.Dir))
+	}
+	table := ""
+	for i, row := range rows {
+		origin := strings.ReplaceAll(sourceMap.Describe(stateList[i], cg.File), "*/", "* /")
+		table += fmt.Sprintf("\t\t\t/* %d %s: %s */\n\t\t\t{ %s },\n", i, stateList[i], origin, strings.Join(row, ", "))
+	}
+
+	stateNames := make([]string, len(stateList))
+	for i, name := range stateList {
+		stateNames[i] = strconv.Quote(name)
+	}
+	symbolChars := make([]string, len(symbolList))
+	for i, symbol := range symbolList {
+		symbolChars[i] = cSymbol(symbol)
+	}
+
+	// Input symbols map to their numbers; anything outside the declared INPUT
+	// or TAPE alphabet, or with neither outside the symbols the machine
+	// mentions, is rejected as there is no table column for it.
+	inputSymbols := cg.Meta.InputSymbols()
+	if inputSymbols == nil {
+		inputSymbols = symbolList
+	}
+	inputCases := ""
+	for _, symbol := range inputSymbols {
+		inputCases += fmt.Sprintf("\t\t\t\tcase %s: return %d;\n", cSymbol(symbol), symbolMap[symbol])
+	}
+
+	symbolType := "uint8_t"
+	if len(symbolList) > 256 {
+		symbolType = "uint16_t"
+	}
+
+	cCode := fmt.Sprintf(`#include <stdint.h>
+		#include <stdio.h>
+		#include <stdlib.h>
+		#include <string.h>
+		#include <time.h>
+
+		#define NUM_STATES %d
+		#define NUM_SYMBOLS %d
+		#define BLANK 0 /* Symbol number of the blank, so fresh cells are zeroed */
+		#define TAPE_CHUNK 65536
+
+		/* Exit codes, the same as tmlang run */
+		#define EXIT_ACCEPTED 0
+		#define EXIT_REJECTED 1
+		#define EXIT_CRASH 2
+		#define EXIT_TIMEOUT 3
+		#define EXIT_USAGE 4
+		#define EXIT_OUT_OF_TAPE 5
+
+		/* Compile with -DMAX_CELLS=n, or run with --max-cells n, to halt with
+		   OUT_OF_TAPE rather than use more than n cells */
+		#ifndef MAX_CELLS
+		#define MAX_CELLS 0
+		#endif
+
+		#define START_STATE %d
+		#define ACCEPT_STATE %d
+		#define REJECT_STATE %d
+
+		typedef %s symbol_t;
+
+		/* What to do on reading a symbol in a state; next is -1 where the state
+		   has no rule, and for every symbol in the halting states */
+		typedef struct {
+			int32_t next;
+			symbol_t write;
+			int8_t move;
+		} rule_t;
+
+		#define NO_RULE {-1, 0, 0}
+
+		static const char *state_names[NUM_STATES] = { %s };
+
+		/* Code point of each symbol number */
+		static const int symbol_chars[NUM_SYMBOLS] = { %s };
+
+		static const rule_t rules[NUM_STATES][NUM_SYMBOLS] = {
+%s		};
+
+		/* Set from the command line */
+		int quiet = 0;       /* --quiet: no summary */
+		int print_final = 0; /* --print-tape: the tape and head after halting */
+		uint64_t max_steps = 0; /* --max-steps: TIMEOUT after this many steps, 0 for no limit */
+		int64_t max_cells = MAX_CELLS;
+
+		/* The tape holds symbol numbers and grows in either direction on demand.
+		   Positions here are indices into it; tape[origin] is the first input
+		   cell, and low/high bound the cells used so far. */
+		symbol_t *tape = NULL;
+		int64_t tape_size = 0;
+		int64_t origin = 0;
+		int64_t head = 0;
+		int64_t low = 0, high = 0;
+		int32_t state = START_STATE;
+		uint64_t steps = 0;
+
+		%s
+		/* Returns the symbol number of an input character, or -1 if it is not
+		   allowed on the input */
+		int input_symbol(int symbol) {
+			switch(symbol) {
+%s				default: return -1;
+			}
+		}
+
+		/* Grows the tape so index i is on it, at least doubling it each time.
+		   Returns how far existing cells moved right. */
+		int64_t grow(int64_t i) {
+			int64_t extra = tape_size > TAPE_CHUNK ? tape_size : TAPE_CHUNK;
+			if (i < 0 && -i > extra) extra = -i;
+			if (i >= tape_size && i - tape_size + 1 > extra) extra = i - tape_size + 1;
+			symbol_t *grown = allocate(NULL, (tape_size + extra) * sizeof(symbol_t));
+			int64_t shift = i < 0 ? extra : 0;
+			memset(grown, BLANK, (tape_size + extra) * sizeof(symbol_t));
+			if (tape_size > 0) memcpy(grown + shift, tape, tape_size * sizeof(symbol_t));
+			free(tape);
+			tape = grown;
+			tape_size += extra;
+			origin += shift;
+			return shift;
+		}
+
+		/* Runs until the machine halts, crashes or hits a limit, and returns
+		   nonzero if it ran out of tape. The hot loop works on locals so that
+		   writes to the tape cannot force the globals to be reloaded. */
+		int run(void) {
+			symbol_t *t = tape;
+			int64_t h = head, lo = low, hi = high;
+			int32_t q = state;
+			uint64_t n = steps;
+			uint64_t limit = max_steps > 0 ? max_steps : UINT64_MAX;
+			int out_of_tape = 0;
+
+			for (;;) {
+				const rule_t *r = &rules[q][t[h]];
+				if (r->next < 0 || n == limit) break;
+				int64_t next = h + r->move;
+				if (next < lo || next > hi) {
+					if (max_cells > 0 && (next < lo ? hi - next : next - lo) + 1 > max_cells) {
+						out_of_tape = 1;
+						break;
+					}
+					if (next < lo) lo = next;
+					else hi = next;
+					if (next < 0 || next >= tape_size) {
+						int64_t shift = grow(next);
+						t = tape;
+						h += shift;
+						next += shift;
+						lo += shift;
+						hi += shift;
+					}
+				}
+				t[h] = r->write;
+				h = next;
+				q = r->next;
+				n++;
+			}
+
+			head = h;
+			low = lo;
+			high = hi;
+			state = q;
+			steps = n;
+			return out_of_tape;
+		}
+
+		/* Prints the tape without leading and trailing blanks, and the head's
+		   offset from its first cell, like tmlang run */
+		void print_tape() {
+			int64_t first = low, last = high;
+			while (first <= last && tape[first] == BLANK) first++;
+			while (last >= first && tape[last] == BLANK) last--;
+			printf("Tape:   ");
+			for(int64_t i = first; i <= last; i++) put_symbol(stdout, symbol_chars[tape[i]]);
+			printf("\nHead:   %%lld\n", (long long)(first <= last ? head - first : 0));
+		}
+
+		int summary(const char *status, int code, double seconds) {
+			if (print_final) print_tape();
+			if (!quiet) {
+				printf("State:  %%s\n", state_names[state]);
+				printf("Steps:  %%llu\n", (unsigned long long)steps);
+				printf("Cells:  %%lld\n", (long long)(high - low + 1));
+				printf("Time:   %%.3f s\n", seconds);
+				printf("Status: %%s\n", status);
+			}
+			return code;
+		}
+
+		int usage(const char *program) {
+			fprintf(stderr, "Usage: %%s [--quiet] [--print-tape] [--max-steps n] [--max-cells n] [input]\n", program);
+			fprintf(stderr, "Input is taken from the argument, or else from stdin.\n");
+			return EXIT_USAGE;
+		}
+
+		int main(int argc, char **argv) {
+			const char *input = NULL;
+			int flags_done = 0;
+			for(int i = 1; i < argc; i++) {
+				const char *arg = argv[i];
+				long long count;
+				if (flags_done || strncmp(arg, "--", 2) != 0) {
+					if (input != NULL) return usage(argv[0]);
+					input = arg;
+				} else if (strcmp(arg, "--") == 0) {
+					flags_done = 1;
+				} else if (strcmp(arg, "--quiet") == 0) {
+					quiet = 1;
+				} else if (strcmp(arg, "--print-tape") == 0) {
+					print_final = 1;
+				} else if (strcmp(arg, "--max-steps") == 0 && i + 1 < argc) {
+					if ((count = parse_count(argv[++i])) < 0) return usage(argv[0]);
+					max_steps = count;
+				} else if (strcmp(arg, "--max-cells") == 0 && i + 1 < argc) {
+					if ((count = parse_count(argv[++i])) < 0) return usage(argv[0]);
+					max_cells = count;
+				} else if (strcmp(arg, "--help") == 0) {
+					usage(argv[0]);
+					return 0;
+				} else {
+					return usage(argv[0]);
+				}
+			}
+			if (input == NULL) input = read_all(stdin);
+
+			grow(strlen(input));
+			int64_t pos = origin;
+			for(int i=0; input[i] != '\0'; ) {
+				int symbol, number;
+				i += decode_symbol(input + i, &symbol);
+				if ((number = input_symbol(symbol)) < 0) {
+					fprintf(stderr, "Invalid input symbol '");
+					put_symbol(stderr, symbol);
+					fprintf(stderr, "'\n");
+					return EXIT_USAGE;
+				}
+				tape[pos++] = number;
+			}
+			head = low = origin;
+			high = pos > origin ? pos - 1 : origin;
+
+			clock_t started = clock();
+			int out_of_tape = run();
+			double seconds = (double)(clock() - started) / CLOCKS_PER_SEC;
+
+			if (state == ACCEPT_STATE) return summary("ACCEPTED", EXIT_ACCEPTED, seconds);
+			if (state == REJECT_STATE) return summary("REJECTED", EXIT_REJECTED, seconds);
+			if (out_of_tape) {
+				fprintf(stderr, "OUT OF TAPE: the machine needs more than %%lld cells\n", (long long)max_cells);
+				return summary("OUT_OF_TAPE", EXIT_OUT_OF_TAPE, seconds);
+			}
+			if (max_steps > 0 && steps == max_steps) return summary("TIMEOUT", EXIT_TIMEOUT, seconds);
+			fprintf(stderr, "CRASH: State %%s has no rule for char '", state_names[state]);
+			put_symbol(stderr, symbol_chars[tape[head]]);
+			fprintf(stderr, "'\n");
+			return summary("CRASH", EXIT_CRASH, seconds);
+		}
+	`, len(stateList), len(symbolList), stateMap[cg.Meta.Start], stateMap[cg.Meta.Accept], stateMap[cg.Meta.Reject],
+		symbolType, strings.Join(stateNames, ", "), strings.Join(symbolChars, ", "), table, cRuntime, inputCases)
+
+	return cCode
+}
+
+// symbolIDs numbers every symbol the machine can meet: the blank first, as
+// 0, then the rest sorted.
+func (cg *CodeGenerator) symbolIDs() ([]string, map[string]int) {
+	blank := cg.Meta.BlankSymbol()
+	symbolSet := make(map[string]bool)
+	for _, symbol := range cg.Meta.InputAlphabet {
+		symbolSet[symbol] = true
+	}
+	for _, symbol := range cg.Meta.TapeAlphabet {
+		symbolSet[symbol] = true
+	}
+	for _, t := range cg.FinalIR {
+		symbolSet[t.Read] = true
+		symbolSet[t.Write] = true
+	}
+	delete(symbolSet, blank)
+
+	symbolList := []string{blank}
+	for symbol := range symbolSet {
+		symbolList = append(symbolList, symbol)
+	}
+	sort.Strings(symbolList[1:])
+
+	symbolMap := make(map[string]int)
+	for i, symbol := range symbolList {
+		symbolMap[symbol] = i
+	}
+	return symbolList, symbolMap
+}
@@ -0,0 +1,88 @@
+// Package tmlang implements the TM-Lang compiler: a lexer, parser and
+// semantic analyzer that turn a .tm source file into a flat list of
+// Turing Machine transitions, plus the C and GraphViz emitters.
+package tmlang
+
+// Options selects which backends Compile runs after analysis.
+type Options struct {
+	EmitC   bool   // Generate the C simulation into Result.C
+	CMode   string // C emission mode: CModeDefault (also "") or CModeFast
+	EmitDot bool   // Generate the GraphViz state diagram into Result.Dot
+	Analyze bool   // Run reachability analysis into Result.Analysis and report its warnings
+	Limits  Limits
+
+	Path     string                       // File the source was read from; IMPORT paths are relative to it
+	ReadFile func(string) ([]byte, error) // Reads IMPORTed files, os.ReadFile when nil
+}
+
+// Result holds every artifact produced by Compile. On failure it still
+// carries whatever was parsed, alongside the Diagnostics.
+type Result struct {
+	IR          IntermediateRepresention // Parsed program, macros not yet expanded
+	Transitions []FlatTransition         // Macro-expanded transition table
+	SourceMap   SourceMap                // Flat state -> where it was written
+	C           string
+	Dot         string
+	Diagnostics Diagnostics // Every error and warning, from all phases
+	Analysis    *AnalysisReport
+}
+
+// Compile runs the full pipeline over sourceCode and returns the parsed
+// program, the flattened transitions and any emitter output requested in opts.
+// The error is non-nil when any phase reported an error; it is the
+// Diagnostics list of errors. Semantic analysis only runs once parsing succeeds.
+func Compile(sourceCode string, opts Options) (*Result, error) {
+
+	result := &Result{}
+
+	ir, diagnostics := parseSource(sourceCode, "", false)
+	result.Diagnostics = diagnostics
+	if len(ir.Imports) > 0 && !result.Diagnostics.HasErrors() {
+		importer := newImporter(opts.ReadFile)
+		importer.blank = ir.Meta.BlankSymbol()
+		result.Diagnostics = append(result.Diagnostics, importer.resolve(&ir, opts.Path)...)
+		result.Diagnostics = append(result.Diagnostics, importer.Diagnostics...)
+	}
+	result.IR = ir
+	result.Diagnostics.Sort()
+
+	if result.Diagnostics.HasErrors() {
+		return result, result.Diagnostics.Errors()
+	}
+
+	var analyzer SemanticAnalyzer
+	analyzer.Limits = opts.Limits
+	analyzer.InitSemanticAnalyzer(ir)
+	finalIR, _ := analyzer.Analyze()
+	result.Transitions = finalIR
+	result.SourceMap = NewSourceMap(finalIR)
+	result.Diagnostics = append(result.Diagnostics, analyzer.Diagnostics...)
+
+	if opts.Analyze && !result.Diagnostics.HasErrors() {
+		report := AnalyzeMachine(ir.Meta, finalIR)
+		result.Analysis = &report
+		result.Diagnostics = append(result.Diagnostics, report.Diagnostics(finalIR)...)
+	}
+	result.Diagnostics.Sort()
+
+	if result.Diagnostics.HasErrors() {
+		return result, result.Diagnostics.Errors()
+	}
+
+	var codegen CodeGenerator
+	codegen.InitCodegen(ir.Meta, finalIR)
+	codegen.File = opts.Path
+
+	if opts.EmitC {
+		if opts.CMode == CModeFast {
+			result.C = codegen.GenerateFastC()
+		} else {
+			result.C = codegen.GenerateC()
+		}
+	}
+	if opts.EmitDot {
+		result.Dot = codegen.GenerateDot()
+	}
+
+	return result, nil
+}
@@ -0,0 +1,276 @@
+package tmlang
+
+import (
+	"fmt"
+	"path/filepath"
+)
+
+// Reasons a Debugger stops running the machine.
+const (
+	StopStep       = "step"       // The requested steps were taken
+	StopBreakpoint = "breakpoint" // A breakpoint matched before the next step
+	StopHalt       = "halt"       // The machine halted; see Simulator.Status
+	StopPause      = "pause"      // MaxSteps steps were taken without stopping
+	StopStart      = "start"      // Running backwards reached the start of the run
+)
+
+// Breakpoint stops a Debugger before a step taken where every condition it
+// sets holds. At least one condition is set.
+type Breakpoint struct {
+	ID     int
+	State  string // Flat state, or a state name as written in MAIN or any macro
+	Symbol string // Symbol under the head
+	File   string // Source file of the rule about to apply, "" for the main file
+	Line   int    // Source line of the rule about to apply
+}
+
+// String describes the conditions, "state q1, symbol 0, line 12".
+func (bp Breakpoint) String() string {
+	text := ""
+	add := func(condition string) {
+		if text != "" {
+			text += ", "
+		}
+		text += condition
+	}
+	if bp.State != "" {
+		add("state " + bp.State)
+	}
+	if bp.Symbol != "" {
+		add("symbol " + QuoteSymbol(bp.Symbol))
+	}
+	if bp.Line > 0 && bp.File != "" {
+		add(fmt.Sprintf("line %s:%d", bp.File, bp.Line))
+	} else if bp.Line > 0 {
+		add(fmt.Sprintf("line %d", bp.Line))
+	}
+	return text
+}
+
+// Stop is why and where a Debugger stopped.
+type Stop struct {
+	Reason     string
+	Breakpoint *Breakpoint // Set when Reason is StopBreakpoint
+}
+
+// Debugger drives a Simulator step by step for interactive debugging, with
+// breakpoints and stepping over or out of CALLed macros by way of the
+// source map. It records every step, so it can also run backwards.
+type Debugger struct {
+	Sim         Simulator
+	Transitions []FlatTransition
+	Breakpoints []Breakpoint
+	MaxSteps    int // Steps a Continue, StepOver or StepOut takes before pausing, 0 for no limit
+
+	meta   Meta
+	input  string
+	nextID int
+}
+
+func (dbg *Debugger) InitDebugger(transitions []FlatTransition, meta Meta, input string) {
+	dbg.Transitions = transitions
+	dbg.meta = meta
+	dbg.input = input
+	dbg.Breakpoints = nil
+	dbg.nextID = 1
+	dbg.Sim.Record = true
+	dbg.Restart()
+}
+
+// Restart puts the machine back at its start with the same input, keeping
+// the breakpoints and Sim.MaxCells.
+func (dbg *Debugger) Restart() {
+	dbg.Sim.InitSimulator(dbg.Transitions, dbg.meta, dbg.input)
+}
+
+// AddBreakpoint numbers bp and adds it.
+func (dbg *Debugger) AddBreakpoint(bp Breakpoint) Breakpoint {
+	bp.ID = dbg.nextID
+	dbg.nextID++
+	dbg.Breakpoints = append(dbg.Breakpoints, bp)
+	return bp
+}
+
+// RemoveBreakpoint deletes the breakpoint numbered id, reporting whether it existed.
+func (dbg *Debugger) RemoveBreakpoint(id int) bool {
+	for i, bp := range dbg.Breakpoints {
+		if bp.ID == id {
+			dbg.Breakpoints = append(dbg.Breakpoints[:i], dbg.Breakpoints[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// HasRulesAt reports whether any rule was written on line of file ("" for
+// the main file), so a line breakpoint there can ever match.
+func (dbg *Debugger) HasRulesAt(file string, line int) bool {
+	for _, t := range dbg.Transitions {
+		if t.Span.Start.Line == line && sameFile(t.Span.File, file) {
+			return true
+		}
+	}
+	return false
+}
+
+// matches reports whether bp holds for the machine's next step.
+func (dbg *Debugger) matches(bp Breakpoint) bool {
+	sim := &dbg.Sim
+	if bp.State != "" && bp.State != sim.State {
+		origin, exists := sim.Origin()
+		if !exists || origin.Name != bp.State {
+			return false
+		}
+	}
+	if bp.Symbol != "" && bp.Symbol != string(sim.Cell(sim.Head)) {
+		return false
+	}
+	if bp.Line > 0 {
+		rule := sim.CurrentRule()
+		if rule == nil || rule.Span.Start.Line != bp.Line || !sameFile(rule.Span.File, bp.File) {
+			return false
+		}
+	}
+	return true
+}
+
+// Hit returns the first breakpoint that holds for the machine's next step,
+// or nil. Running only checks after a step, so a caller starting a run can
+// use it to stop on the first step too.
+func (dbg *Debugger) Hit() *Breakpoint {
+	for i := range dbg.Breakpoints {
+		if dbg.matches(dbg.Breakpoints[i]) {
+			return &dbg.Breakpoints[i]
+		}
+	}
+	return nil
+}
+
+// sameFile compares a span's file with a breakpoint's; a breakpoint file
+// without a directory matches any file of that name.
+func sameFile(spanFile string, bpFile string) bool {
+	if spanFile == "" || bpFile == "" {
+		return spanFile == bpFile
+	}
+	if filepath.Clean(spanFile) == filepath.Clean(bpFile) {
+		return true
+	}
+	return filepath.Base(bpFile) == bpFile && filepath.Base(spanFile) == bpFile
+}
+
+// Depth is the number of macro CALLs the current state is nested in.
+func (dbg *Debugger) Depth() int {
+	return len(dbg.CallStack())
+}
+
+// CallStack returns the CALLs that led to the current state, outermost
+// first; empty in MAIN and in halting states.
+func (dbg *Debugger) CallStack() []CallSite {
+	origin, _ := dbg.Sim.Origin()
+	return origin.Calls
+}
+
+// Step takes up to n steps, stopping early at a halt or a breakpoint.
+func (dbg *Debugger) Step(n int) Stop {
+	taken := 0
+	return dbg.run(func() bool {
+		taken++
+		return taken >= n
+	}, false)
+}
+
+// Continue runs until a breakpoint or a halt.
+func (dbg *Debugger) Continue() Stop {
+	return dbg.run(func() bool { return false }, true)
+}
+
+// StepOver takes one step, and if it entered a CALLed macro keeps running
+// until the machine is back out of it.
+func (dbg *Debugger) StepOver() Stop {
+	depth := dbg.Depth()
+	return dbg.run(func() bool { return dbg.Depth() <= depth }, true)
+}
+
+// StepOut runs until the machine leaves the macro it is in. In MAIN it runs
+// like Continue.
+func (dbg *Debugger) StepOut() Stop {
+	depth := dbg.Depth()
+	return dbg.run(func() bool { return dbg.Depth() < depth }, true)
+}
+
+// run steps until done reports true after a step, the machine halts, or a
+// breakpoint matches the next step. Breakpoints are only checked after the
+// first step, so running again from a breakpoint moves on. limited runs
+// pause after MaxSteps steps.
+func (dbg *Debugger) run(done func() bool, limited bool) Stop {
+	for taken := 0; ; taken++ {
+		if dbg.Sim.Status != StatusRunning {
+			return Stop{Reason: StopHalt}
+		}
+		if limited && dbg.MaxSteps > 0 && taken >= dbg.MaxSteps {
+			return Stop{Reason: StopPause}
+		}
+		if !dbg.Sim.Step() {
+			return Stop{Reason: StopHalt}
+		}
+		if done() {
+			return Stop{Reason: StopStep}
+		}
+		if bp := dbg.Hit(); bp != nil {
+			return Stop{Reason: StopBreakpoint, Breakpoint: bp}
+		}
+	}
+}
+
+// StepBack undoes up to n steps, stopping early at the start of the run or
+// at a breakpoint.
+func (dbg *Debugger) StepBack(n int) Stop {
+	taken := 0
+	return dbg.runBack(func() bool {
+		taken++
+		return taken >= n
+	})
+}
+
+// ReverseContinue runs backwards until a breakpoint or the start of the run.
+func (dbg *Debugger) ReverseContinue() Stop {
+	return dbg.runBack(func() bool { return false })
+}
+
+// runBack is run in reverse: it undoes steps until done reports true, the
+// start of the run is reached, or a breakpoint matches the step about to
+// be taken again. No step limit is needed, since the history is finite.
+func (dbg *Debugger) runBack(done func() bool) Stop {
+	for {
+		if !dbg.Sim.Back() {
+			return Stop{Reason: StopStart}
+		}
+		if done() {
+			return Stop{Reason: StopStep}
+		}
+		if bp := dbg.Hit(); bp != nil {
+			return Stop{Reason: StopBreakpoint, Breakpoint: bp}
+		}
+	}
+}
+
+// GoTo moves the machine to step, backwards or forwards, ignoring
+// breakpoints. Going forwards stops at a halt, like Step.
+func (dbg *Debugger) GoTo(step int) Stop {
+	dbg.Sim.Seek(step)
+	if dbg.Sim.Status != StatusRunning {
+		return Stop{Reason: StopHalt}
+	}
+	return Stop{Reason: StopStep}
+}
+
+// FindWrite moves the machine to the first step after which the cell at
+// position came to hold symbol, and reports whether any step so far wrote
+// it there.
+func (dbg *Debugger) FindWrite(position int, symbol rune) bool {
+	step, found := dbg.Sim.FirstWrite(position, symbol)
+	if found {
+		dbg.Sim.Seek(step)
+	}
+	return found
+}
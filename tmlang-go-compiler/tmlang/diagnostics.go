@@ -0,0 +1,218 @@
+package tmlang
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+type Severity string
+
+const (
+	SeverityError   Severity = "error"
+	SeverityWarning Severity = "warning"
+	SeverityInfo    Severity = "info"
+)
+
+// Diagnostic codes, stable across releases so tooling can match on them.
+const (
+	CodeUnexpectedCharacter = "unexpected-character"
+	CodeUnexpectedToken     = "unexpected-token"
+	CodeImportCycle         = "import-cycle"
+	CodeImportError         = "import-error"
+	CodeIgnoredSection      = "ignored-section"
+	CodeDuplicateImport     = "duplicate-import"
+	CodeInvalidSymbol       = "invalid-symbol"
+	CodeMissingSection      = "missing-section"
+	CodeDuplicateSection    = "duplicate-section"
+	CodeSectionOrder        = "section-order"
+	CodeMissingConfig       = "missing-config"
+	CodeDuplicateConfig     = "duplicate-config"
+	CodeDuplicateSymbol     = "duplicate-symbol"
+	CodeUnknownSymbol       = "unknown-symbol"
+	CodeInvalidAlphabet     = "invalid-alphabet"
+	CodeDuplicateMacro      = "duplicate-macro"
+	CodeDuplicateParam      = "duplicate-param"
+	CodeParamType           = "param-type"
+	CodeUnusedParam         = "unused-param"
+	CodeMacroArity          = "macro-arity"
+	CodeArgumentType        = "argument-type"
+	CodeDuplicateExit       = "duplicate-exit"
+	CodeUnboundExit         = "unbound-exit"
+	CodeUnknownExit         = "unknown-exit"
+	CodeEmptyMacro          = "empty-macro"
+	CodeUndefinedMacro      = "undefined-macro"
+	CodeRecursiveMacro      = "recursive-macro"
+	CodeExpansionLimit      = "expansion-limit"
+	CodeReturnOutsideMacro  = "return-outside-macro"
+	CodeNondeterministic    = "nondeterministic-transition"
+	CodeDuplicateTransition = "duplicate-transition"
+	CodeOverlappingRead     = "overlapping-read"
+	CodeEmptyRead           = "empty-read"
+	CodeInferredAlphabet    = "inferred-alphabet"
+	CodeUnreachableState    = "unreachable-state"
+	CodeDeadState           = "dead-state"
+	CodeRuleOnHaltingState  = "rule-on-halting-state"
+	CodeMissingTransition   = "missing-transition"
+)
+
+// Position is a 1-based line and column; columns count runes.
+type Position struct {
+	Line   int `json:"line"`
+	Column int `json:"column"`
+}
+
+// Span is a half-open source range [Start, End). File is set for spans in an
+// IMPORTed file and empty for the file being compiled.
+type Span struct {
+	Start Position `json:"start"`
+	End   Position `json:"end"`
+	File  string   `json:"file,omitempty"`
+}
+
+// Location formats the start of span as file:line:col, using mainFile for
+// spans in the file being compiled. Without a file name it is line:col.
+func (span Span) Location(mainFile string) string {
+	file := span.File
+	if file == "" {
+		file = mainFile
+	}
+	if file == "" {
+		return fmt.Sprintf("%d:%d", span.Start.Line, span.Start.Column)
+	}
+	return fmt.Sprintf("%s:%d:%d", file, span.Start.Line, span.Start.Column)
+}
+
+// To returns the span from the start of span to the end of end.
+func (span Span) To(end Span) Span {
+	return Span{span.Start, end.End, span.File}
+}
+
+// Related points at another location that explains a Diagnostic,
+// e.g. the first definition of a duplicated macro.
+type Related struct {
+	Span    Span   `json:"span"`
+	Message string `json:"message"`
+}
+
+// Fix is a suggested edit replacing the text in Span with Replacement.
+type Fix struct {
+	Message     string `json:"message"`
+	Span        Span   `json:"span"`
+	Replacement string `json:"replacement"`
+}
+
+// Diagnostic is a single error or warning produced by any compiler phase.
+type Diagnostic struct {
+	File     string    `json:"file,omitempty"` // Set by frontends that know the path
+	Severity Severity  `json:"severity"`
+	Code     string    `json:"code"`
+	Message  string    `json:"message"`
+	Span     Span      `json:"span"`
+	Related  []Related `json:"related,omitempty"`
+	Fix      *Fix      `json:"fix,omitempty"`
+}
+
+func (d Diagnostic) Error() string {
+	return fmt.Sprintf("%d:%d: %s: %s", d.Span.Start.Line, d.Span.Start.Column, d.Severity, d.Message)
+}
+
+// Diagnostics is the full list reported by a compile. It implements error
+// so callers that only care about failure can treat it as one.
+type Diagnostics []Diagnostic
+
+func (ds Diagnostics) Error() string {
+	lines := make([]string, 0, len(ds))
+	for _, d := range ds {
+		lines = append(lines, d.Error())
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (ds Diagnostics) HasErrors() bool {
+	for _, d := range ds {
+		if d.Severity == SeverityError {
+			return true
+		}
+	}
+	return false
+}
+
+// Errors returns only the diagnostics with error severity.
+func (ds Diagnostics) Errors() Diagnostics {
+	var errs Diagnostics
+	for _, d := range ds {
+		if d.Severity == SeverityError {
+			errs = append(errs, d)
+		}
+	}
+	return errs
+}
+
+// Sort orders diagnostics by file, the compiled file first, then by their
+// start position.
+func (ds Diagnostics) Sort() {
+	sort.SliceStable(ds, func(i, j int) bool {
+		if ds[i].Span.File != ds[j].Span.File {
+			return ds[i].Span.File < ds[j].Span.File
+		}
+		a, b := ds[i].Span.Start, ds[j].Span.Start
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+		return a.Column < b.Column
+	})
+}
+
+func newError(code string, span Span, format string, args ...any) Diagnostic {
+	return Diagnostic{
+		File:     span.File,
+		Severity: SeverityError,
+		Code:     code,
+		Message:  fmt.Sprintf(format, args...),
+		Span:     span,
+	}
+}
+
+func newWarning(code string, span Span, format string, args ...any) Diagnostic {
+	return Diagnostic{
+		File:     span.File,
+		Severity: SeverityWarning,
+		Code:     code,
+		Message:  fmt.Sprintf(format, args...),
+		Span:     span,
+	}
+}
+
+// closestName returns the candidate with the smallest edit distance to name,
+// if it is close enough to be a plausible typo.
+func closestName(name string, candidates []string) (string, bool) {
+	best, bestDistance := "", len(name)/2+2
+	for _, candidate := range candidates {
+		if d := editDistance(name, candidate); d < bestDistance {
+			best, bestDistance = candidate, d
+		}
+	}
+	return best, best != ""
+}
+
+func editDistance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	curr := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		curr[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(rb)]
+}
@@ -0,0 +1,262 @@
+package tmlang
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// Indentation used by the canonical layout.
+const (
+	indentSection = ""
+	indentBody    = "    "     // CONFIG keys, DEF headers, MAIN transitions
+	indentMacro   = "        " // Macro bodies
+)
+
+// formatLine is one output line before alignment.
+type formatLine struct {
+	Indent  string
+	Columns []string // Transition columns to align; nil for other lines
+	Text    string   // Whole text for non-transition lines
+	Comment string   // Trailing // comment
+	Blank   bool
+}
+
+// Format returns source in canonical layout: sections at column 0, CONFIG keys
+// and DEF headers indented once, macro bodies twice, and the columns of each
+// run of transitions aligned. Symbol literals are rewritten in their shortest
+// form and comments are preserved. Source with syntax errors is not
+// formatted; the error lists them. A library without CONFIG or MAIN is
+// formatted like any other file.
+func Format(source string) (string, error) {
+	var lexer Lexer
+	lexer.InitLexer(source)
+	tokens := lexer.TokenizeSource()
+	if lexer.Diagnostics.HasErrors() {
+		return "", lexer.Diagnostics.Errors()
+	}
+
+	var parser Parser
+	parser.InitParser(tokens)
+	parser.Library = true
+	if _, err := parser.Parse(); err != nil {
+		return "", err
+	}
+
+	lexer.InitLexer(source)
+	lexer.KeepComments = true
+	tokens = lexer.TokenizeSource()
+
+	lineCount := strings.Count(source, "\n") + 1
+	byLine := make([][]Token, lineCount+1)
+	for _, token := range tokens {
+		if token.TypeOfToken == SYMBOL {
+			token.Value = QuoteSymbol(symbolValue(token)) // 'a' -> a, '\u03b1' -> 'α'
+		}
+		if token.TypeOfToken != EOF {
+			byLine[token.Line] = append(byLine[token.Line], token)
+		}
+	}
+
+	var lines []formatLine
+	section, inMacro := "", false
+
+	for lineNumber := 1; lineNumber <= lineCount; lineNumber++ {
+		lineTokens := byLine[lineNumber]
+		if len(lineTokens) == 0 {
+			lines = append(lines, formatLine{Blank: true})
+			continue
+		}
+
+		var line formatLine
+		if last := lineTokens[len(lineTokens)-1]; last.TypeOfToken == COMMENT {
+			line.Comment = last.Value
+			lineTokens = lineTokens[:len(lineTokens)-1]
+		}
+
+		if len(lineTokens) == 0 { // Comment-only line, indented like the code after it
+			line.Indent = commentIndent(byLine[lineNumber+1:], section, inMacro)
+			lines = append(lines, line)
+			continue
+		}
+
+		first := lineTokens[0]
+		switch {
+		case first.TypeOfToken == SECTION:
+			section, inMacro = first.Value, false
+			line.Indent = indentSection
+		case first.Value == "IMPORT":
+			line.Indent = indentSection
+		case first.Value == "DEF":
+			inMacro = true
+			line.Indent = indentBody
+		case section == "MACROS:" && inMacro:
+			line.Indent = indentMacro
+		default:
+			line.Indent = indentBody
+		}
+
+		line.Columns = transitionColumns(lineTokens)
+		if line.Columns == nil {
+			line.Text = joinTokens(lineTokens)
+		}
+		lines = append(lines, line)
+	}
+
+	alignTransitions(lines)
+	return renderLines(lines), nil
+}
+
+// commentIndent indents a full-line comment like the next line of code.
+func commentIndent(following [][]Token, section string, inMacro bool) string {
+	for _, lineTokens := range following {
+		if len(lineTokens) == 0 || lineTokens[0].TypeOfToken == COMMENT {
+			continue
+		}
+		switch {
+		case lineTokens[0].TypeOfToken == SECTION, lineTokens[0].Value == "IMPORT":
+			return indentSection
+		case lineTokens[0].Value == "DEF":
+			return indentBody
+		case section == "MACROS:" && inMacro:
+			return indentMacro
+		}
+		return indentBody
+	}
+	if section == "" {
+		return indentSection
+	}
+	return indentBody
+}
+
+// joinTokens prints tokens with one space between them, except before , : } ( ) .
+// and after { ! ( .
+func joinTokens(tokens []Token) string {
+	var sb strings.Builder
+	for i, token := range tokens {
+		if i > 0 && !noSpaceBefore[token.TypeOfToken] && !noSpaceAfter[tokens[i-1].TypeOfToken] {
+			sb.WriteString(" ")
+		}
+		sb.WriteString(token.Value)
+	}
+	return sb.String()
+}
+
+// transitionColumns splits "src, read -> write, dir, target" into the
+// columns "src,", "read", "->", "write,", "dir,", "target".
+// It returns nil for lines that are not a single transition.
+func transitionColumns(tokens []Token) []string {
+	if tokens[0].TypeOfToken != ID {
+		return nil
+	}
+
+	var columns []string
+	start := 0
+	cut := func(end int) {
+		columns = append(columns, joinTokens(tokens[start:end]))
+		start = end
+	}
+
+	for i, token := range tokens {
+		switch {
+		case token.TypeOfToken == COMMA && len(columns) == 0: // After src
+			cut(i + 1)
+		case token.TypeOfToken == ARROW && len(columns) == 1: // After read
+			cut(i)
+			cut(i + 1)
+		case token.TypeOfToken == COMMA && (len(columns) == 3 || len(columns) == 4): // After write, dir
+			cut(i + 1)
+		}
+	}
+	if len(columns) != 5 || start == len(tokens) {
+		return nil
+	}
+	cut(len(tokens))
+	return columns
+}
+
+// alignTransitions pads the columns and trailing comments of each run of
+// transition lines. Blank lines and other statements end a run; full-line
+// comments do not.
+func alignTransitions(lines []formatLine) {
+	for start := 0; start < len(lines); {
+		if lines[start].Columns == nil {
+			start++
+			continue
+		}
+
+		end := start
+		for end < len(lines) && !lines[end].Blank && (lines[end].Columns != nil || lines[end].Text == "") {
+			end++
+		}
+
+		var widths []int
+		for i := start; i < end; i++ {
+			for c, column := range lines[i].Columns {
+				if c >= len(widths) {
+					widths = append(widths, 0)
+				}
+				widths[c] = max(widths[c], utf8.RuneCountInString(column))
+			}
+		}
+
+		codeWidth := 0
+		for i := start; i < end; i++ {
+			if lines[i].Columns == nil {
+				continue
+			}
+			parts := make([]string, len(lines[i].Columns))
+			for c, column := range lines[i].Columns {
+				if c < len(parts)-1 {
+					column = padRight(column, widths[c])
+				}
+				parts[c] = column
+			}
+			lines[i].Text = strings.Join(parts, " ")
+			codeWidth = max(codeWidth, utf8.RuneCountInString(lines[i].Text))
+		}
+
+		for i := start; i < end; i++ {
+			if lines[i].Columns != nil && lines[i].Comment != "" {
+				lines[i].Text = padRight(lines[i].Text, codeWidth)
+			}
+		}
+		start = end
+	}
+}
+
+var (
+	noSpaceBefore = map[TokenType]bool{COMMA: true, COLON: true, RBRACE: true, LPAREN: true, RPAREN: true, DOT: true}
+	noSpaceAfter  = map[TokenType]bool{LBRACE: true, NOT: true, LPAREN: true, DOT: true}
+)
+
+func padRight(text string, width int) string {
+	return text + strings.Repeat(" ", width-utf8.RuneCountInString(text))
+}
+
+// renderLines joins the lines, collapsing runs of blank lines and trimming
+// blank lines at either end of the file.
+func renderLines(lines []formatLine) string {
+	var out []string
+	for _, line := range lines {
+		if line.Blank {
+			if len(out) > 0 && out[len(out)-1] != "" {
+				out = append(out, "")
+			}
+			continue
+		}
+
+		text := line.Indent + line.Text
+		if line.Comment != "" {
+			if line.Text != "" {
+				text += " "
+			}
+			text += line.Comment
+		}
+		out = append(out, text)
+	}
+
+	for len(out) > 0 && out[len(out)-1] == "" {
+		out = out[:len(out)-1]
+	}
+	return strings.Join(out, "\n") + "\n"
+}
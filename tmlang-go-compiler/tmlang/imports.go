@@ -0,0 +1,214 @@
+package tmlang
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// parseSource lexes and parses one file. file is recorded in every span and
+// is empty for the file being compiled.
+func parseSource(sourceCode string, file string, library bool) (IntermediateRepresention, Diagnostics) {
+	var lexer Lexer
+	lexer.InitLexer(sourceCode)
+	lexer.File = file
+	tokens := lexer.TokenizeSource()
+	diagnostics := append(Diagnostics{}, lexer.Diagnostics...)
+
+	var parser Parser
+	parser.InitParser(tokens)
+	parser.Library = library
+	ir, _ := parser.Parse()
+
+	// A skipped character usually derails the rest of its line, so only the
+	// lexer's report is kept for lines it already flagged.
+	badLines := make(map[int]bool)
+	for _, d := range lexer.Diagnostics {
+		badLines[d.Span.Start.Line] = true
+	}
+	for _, d := range parser.Diagnostics {
+		if !badLines[d.Span.Start.Line] {
+			diagnostics = append(diagnostics, d)
+		}
+	}
+	return ir, diagnostics
+}
+
+// importedFile is a library parsed once, however many files import it.
+type importedFile struct {
+	IR        IntermediateRepresention
+	HasErrors bool
+	FirstErr  Span
+}
+
+// importer loads the files named by IMPORT lines, recursively, and merges
+// their macros into the importing program under each import's namespace.
+type importer struct {
+	readFile    func(string) ([]byte, error)
+	stack       []string // Files being imported, outermost first, for cycle detection
+	files       map[string]*importedFile
+	blank       string      // Blank symbol of the program, written _ in std: libraries
+	Diagnostics Diagnostics // Everything reported inside imported files
+}
+
+func newImporter(readFile func(string) ([]byte, error)) *importer {
+	if readFile == nil {
+		readFile = os.ReadFile
+	}
+	return &importer{readFile: readFile, files: make(map[string]*importedFile)}
+}
+
+// resolve merges the macros of every file ir imports into ir.Macros as
+// <namespace>.<macro>. path is the file ir was parsed from; IMPORT paths
+// are relative to its directory. The returned diagnostics point at ir's own
+// IMPORT lines.
+func (imp *importer) resolve(ir *IntermediateRepresention, path string) Diagnostics {
+	var diagnostics Diagnostics
+	imp.stack = append(imp.stack, filepath.Clean(path))
+	defer func() { imp.stack = imp.stack[:len(imp.stack)-1] }()
+
+	for _, statement := range ir.Imports {
+		file := statement.Path
+		if !strings.HasPrefix(file, stdPrefix) && !filepath.IsAbs(file) {
+			file = filepath.Join(filepath.Dir(path), file)
+		}
+
+		if cycle := imp.cycle(file); cycle != nil {
+			diagnostics = append(diagnostics, newError(CodeImportCycle, statement.PathSpan, "Import cycle: %s", strings.Join(cycle, " -> ")))
+			continue
+		}
+
+		library, err := imp.load(file)
+		if err != nil {
+			diagnostics = append(diagnostics, newError(CodeImportError, statement.PathSpan, "Cannot import %s: %v", file, err))
+			continue
+		}
+		if library.HasErrors {
+			diagnostic := newError(CodeImportError, statement.PathSpan, "Imported file %s has errors", file)
+			diagnostic.Related = []Related{{library.FirstErr, "first error is here"}}
+			diagnostics = append(diagnostics, diagnostic)
+			continue
+		}
+
+		for name, macro := range library.IR.Macros {
+			macro.Name = statement.Namespace + "." + name
+			macro.Body = qualifyCalls(macro.Body, statement.Namespace)
+			ir.Macros[macro.Name] = macro
+		}
+	}
+	return diagnostics
+}
+
+// load reads and parses file, resolving its own imports. The result is
+// cached so a library imported along several paths is reported once.
+func (imp *importer) load(file string) (*importedFile, error) {
+	if library, exists := imp.files[filepath.Clean(file)]; exists {
+		return library, nil
+	}
+
+	read := imp.readFile
+	if strings.HasPrefix(file, stdPrefix) {
+		read = readStd
+	}
+	source, err := read(file)
+	if err != nil {
+		var pathErr *fs.PathError
+		if errors.As(err, &pathErr) {
+			err = pathErr.Err
+		}
+		return nil, err
+	}
+
+	ir, diagnostics := parseSource(string(source), file, true)
+	if strings.HasPrefix(file, stdPrefix) && imp.blank != "_" && !diagnostics.HasErrors() {
+		diagnostics = append(diagnostics, replaceBlank(&ir, imp.blank)...)
+	}
+	for _, section := range []string{"CONFIG:", "MAIN:", "TESTS:"} {
+		if span, exists := ir.Sections[section]; exists {
+			diagnostics = append(diagnostics, newWarning(CodeIgnoredSection, span, "Section %s of an imported file is ignored, only its macros are used", section))
+		}
+	}
+	if !diagnostics.HasErrors() {
+		diagnostics = append(diagnostics, imp.resolve(&ir, file)...)
+	}
+
+	library := &importedFile{IR: ir}
+	if errs := diagnostics.Errors(); len(errs) > 0 {
+		library.HasErrors = true
+		library.FirstErr = errs[0].Span
+	}
+	imp.files[filepath.Clean(file)] = library
+	imp.Diagnostics = append(imp.Diagnostics, diagnostics...)
+	return library, nil
+}
+
+// cycle returns the chain of imports leading back to file, or nil.
+func (imp *importer) cycle(file string) []string {
+	file = filepath.Clean(file)
+	for i, open := range imp.stack {
+		if open == file {
+			return append(append([]string{}, imp.stack[i:]...), file)
+		}
+	}
+	return nil
+}
+
+// replaceBlank rewrites the _ of a std: library, its blank, to blank, the
+// program's own. A library that already reads or writes blank as data would
+// no longer tell the two apart, so its first such use is reported instead.
+func replaceBlank(ir *IntermediateRepresention, blank string) Diagnostics {
+	var diagnostics Diagnostics
+	replace := func(symbol string, span Span) string {
+		switch symbol {
+		case "_":
+			return blank
+		case blank:
+			diagnostics = append(diagnostics, newError(CodeImportError, span, "%s is the BLANK of the importing program, but this library uses it as a symbol", QuoteSymbol(blank)))
+		}
+		return symbol
+	}
+
+	for _, macro := range ir.Macros { // Freshly parsed, so rewritten in place
+		for i := range macro.Body {
+			transition := &macro.Body[i]
+			if transition.ReadType == "SYMBOL" && !transition.IsParam("READ", 0) {
+				transition.Read = replace(transition.Read, transition.ReadSpan)
+			}
+			for j, symbol := range transition.ReadSet {
+				if !transition.IsParam("SET", j) {
+					transition.ReadSet[j] = replace(symbol, transition.ReadSpan)
+				}
+			}
+			if !transition.WriteSame && !transition.IsParam("WRITE", 0) {
+				transition.Write = replace(transition.Write, transition.WriteSpan)
+			}
+			for j, arg := range transition.Target.Args {
+				if arg.Type == "SYMBOL" {
+					transition.Target.Args[j].Value = replace(arg.Value, arg.Span)
+				}
+			}
+		}
+	}
+	if len(diagnostics) > 1 { // One is enough to tell the library can't be used
+		diagnostics.Sort()
+		diagnostics = diagnostics[:1]
+	}
+	return diagnostics
+}
+
+// qualifyCalls prefixes namespace to every CALL in a library macro, so it
+// resolves against the library's macros once merged into the importing
+// program and never against the importer's own.
+func qualifyCalls(body []Transition, namespace string) []Transition {
+	qualified := make([]Transition, len(body))
+	for i, transition := range body {
+		if transition.Target.Type == "CALL" {
+			transition.Target.Name = namespace + "." + transition.Target.Name
+			transition.Target.Namespace = namespace + "." + transition.Target.Namespace
+		}
+		qualified[i] = transition
+	}
+	return qualified
+}
@@ -0,0 +1,256 @@
+package tmlang
+
+/*
+Example Code,
+
+CONFIG:
+    START: q0
+    ACCEPT: done
+    REJECT: fail
+MACROS:
+    DEF seek_blank:
+        q0, 0 -> 1, R, q0
+        q0, _ -> _, S, RETURN
+MAIN:
+    q0, 1 -> 0, R, CALL seek_blank -> done
+*/
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+type TokenType string
+
+const (
+	SECTION   TokenType = "SECTION"  // CONFIG:, MACROS:, MAIN:, TESTS:
+	KEYWORD   TokenType = "KEYWORD"  // START:, ACCEPT:, REJECT:, BLANK:, INPUT:, TAPE:, DEF, CALL, RETURN, IMPORT, AS
+	ID        TokenType = "ID"       // Identifiers (q0, my_macro)
+	SYMBOL    TokenType = "SYMBOL"   // 0, 1, _, '#', '\'', '\u03b1'
+	DIRECTION TokenType = "DIR"      // L, R, S
+	ARROW     TokenType = "ARROW"    // ->
+	WILDCARD  TokenType = "WILDCARD" // * reads any symbol without its own rule
+	NOT       TokenType = "NOT"      // ! negates a read
+	LBRACE    TokenType = "LBRACE"   // { opens a symbol set
+	RBRACE    TokenType = "RBRACE"   // }
+	SAME      TokenType = "SAME"     // = writes back the symbol read
+	LPAREN    TokenType = "LPAREN"   // ( opens macro parameters or arguments
+	RPAREN    TokenType = "RPAREN"   // )
+	DOT       TokenType = "DOT"      // . in namespaced macro names, lib.move_end
+	STRING    TokenType = "STRING"   // "path/to/lib.tm", "0110"
+	NUMBER    TokenType = "NUMBER"   // 1000, two digits or more; a lone digit is a SYMBOL
+	COMMA     TokenType = "COMMA"    // ,
+	COLON     TokenType = "COLON"    // :
+	NEWLINE   TokenType = "NEWLINE"  // \n
+	SKIP      TokenType = "SKIP"
+	COMMENT   TokenType = "COMMENT"
+	MISMATCH  TokenType = "MISMATCH"
+	EOF       TokenType = "EOF" // End of File
+)
+
+func (token *Token) isNil() bool {
+	return token.Line == 0 && token.TypeOfToken == "" && token.Value == ""
+}
+
+// Token is a single lexeme produced by the Lexer.
+type Token struct {
+	TypeOfToken TokenType
+	Line        int
+	Column      int
+	Value       string // For Ex: ->, CONFIG:
+	File        string // Set when lexing an IMPORTed file
+}
+
+// Span covers the token's text; tokens never cross a line.
+func (token *Token) Span() Span {
+	start := Position{token.Line, token.Column}
+	end := Position{token.Line, token.Column + utf8.RuneCountInString(token.Value)}
+	return Span{start, end, token.File}
+}
+
+type Rule struct {
+	TypeOfToken TokenType
+	Regex       *regexp.Regexp
+}
+
+// Lexer splits TM-Lang source into Tokens using an ordered list of Rules.
+type Lexer struct {
+	SourceCode  string
+	Tokens      []Token
+	CurrentLine int
+	LineStart   int // Byte offset of the current line, for columns
+	Rules       []Rule
+	Diagnostics Diagnostics
+
+	KeepComments bool   // Emit COMMENT tokens instead of skipping them, for the formatter
+	File         string // Path recorded in every token, for IMPORTed files
+}
+
+func (lexer *Lexer) InitLexer(src string) {
+	lexer.CurrentLine = 1
+	lexer.LineStart = 0
+	lexer.SourceCode = src
+	lexer.Tokens = nil
+	lexer.Diagnostics = nil
+
+	lexer.Rules = []Rule{
+		{SECTION, regexp.MustCompile(`^(CONFIG:|MACROS:|MAIN:|TESTS:)`)},
+		{KEYWORD, regexp.MustCompile(`^(START:|ACCEPT:|REJECT:|BLANK:|INPUT:|TAPE:)`)},
+		{KEYWORD, regexp.MustCompile(`^(DEF|CALL|RETURN|IMPORT|AS)\b`)},
+		{ARROW, regexp.MustCompile(`^->`)},
+		{WILDCARD, regexp.MustCompile(`^\*`)},
+		{NOT, regexp.MustCompile(`^!`)},
+		{LBRACE, regexp.MustCompile(`^\{`)},
+		{RBRACE, regexp.MustCompile(`^\}`)},
+		{SAME, regexp.MustCompile(`^=`)},
+		{LPAREN, regexp.MustCompile(`^\(`)},
+		{RPAREN, regexp.MustCompile(`^\)`)},
+		{DOT, regexp.MustCompile(`^\.`)},
+		{STRING, regexp.MustCompile(`^"[^"\n]*"`)},
+		{COMMA, regexp.MustCompile(`^,`)},
+		{COLON, regexp.MustCompile(`^:`)},
+		{DIRECTION, regexp.MustCompile(`^(L|R|S)\b`)},      //L R S are reserved
+		{ID, regexp.MustCompile(`^[a-zA-Z][a-zA-Z0-9_]+`)}, // Minimum 2 chars for state ID, must start with letter
+		{NUMBER, regexp.MustCompile(`^[0-9][0-9]+`)},
+		{SYMBOL, regexp.MustCompile(`^[0-9a-zA-Z_]`)},
+		{SYMBOL, regexp.MustCompile(`^'(\\.|[^'\\\n])*'?`)}, // Quoted literal, checked by UnquoteSymbol
+		{NEWLINE, regexp.MustCompile(`^\n`)},
+		{SKIP, regexp.MustCompile(`^[ \t\r]+`)},
+		{COMMENT, regexp.MustCompile(`^//.*`)},
+		{MISMATCH, regexp.MustCompile(`^.`)},
+	}
+}
+
+func (lexer *Lexer) column(pos int) int {
+	return utf8.RuneCountInString(lexer.SourceCode[lexer.LineStart:pos]) + 1
+}
+
+// TokenizeSource returns the token stream terminated by an EOF token.
+// Unrecognised characters are reported in lexer.Diagnostics and skipped.
+func (lexer *Lexer) TokenizeSource() []Token {
+
+	pos := 0
+
+	for pos < len(lexer.SourceCode) {
+
+		for _, rule := range lexer.Rules {
+			location := rule.Regex.FindStringIndex(lexer.SourceCode[pos:]) // location has start and end position of the match
+
+			if location != nil && location[0] == 0 { // If a token type match is found
+				textValue := lexer.SourceCode[pos : pos+location[1]]
+
+				switch rule.TypeOfToken {
+				case NEWLINE:
+					lexer.CurrentLine++
+					lexer.LineStart = pos + location[1]
+				case SKIP:
+					// skipping
+				case COMMENT:
+					if lexer.KeepComments {
+						lexer.Tokens = append(lexer.Tokens, Token{
+							TypeOfToken: COMMENT,
+							Value:       strings.TrimRight(textValue, " \t\r"),
+							Line:        lexer.CurrentLine,
+							Column:      lexer.column(pos),
+						})
+					}
+				case SYMBOL:
+					token := Token{SYMBOL, lexer.CurrentLine, lexer.column(pos), textValue, lexer.File}
+					if _, err := UnquoteSymbol(textValue); err != nil {
+						lexer.Diagnostics = append(lexer.Diagnostics, newError(CodeInvalidSymbol, token.Span(), "%v", err))
+					} else {
+						lexer.Tokens = append(lexer.Tokens, token)
+					}
+				case MISMATCH:
+					token := Token{MISMATCH, lexer.CurrentLine, lexer.column(pos), textValue, lexer.File}
+					lexer.Diagnostics = append(lexer.Diagnostics, newError(
+						CodeUnexpectedCharacter,
+						token.Span(),
+						"Unexpected character %q",
+						textValue,
+					))
+				default:
+					lexer.Tokens = append(lexer.Tokens, Token{
+						TypeOfToken: rule.TypeOfToken,
+						Value:       textValue,
+						Line:        lexer.CurrentLine,
+						Column:      lexer.column(pos),
+						File:        lexer.File,
+					})
+				}
+				pos += location[1]
+				break
+			}
+
+		}
+	}
+
+	lexer.Tokens = append(lexer.Tokens, Token{
+		TypeOfToken: EOF,
+		Value:       "",
+		Line:        lexer.CurrentLine,
+		Column:      lexer.column(pos),
+		File:        lexer.File,
+	})
+
+	return lexer.Tokens
+
+}
+
+// UnquoteSymbol returns the tape symbol written by a SYMBOL token: a bare
+// character, or a quoted literal holding exactly one character or one of the
+// escapes \', \\ or \uXXXX.
+func UnquoteSymbol(text string) (string, error) {
+	if !strings.HasPrefix(text, "'") {
+		return text, nil
+	}
+	if len(text) < 2 || !strings.HasSuffix(text, "'") {
+		return "", fmt.Errorf("Unterminated symbol literal %s", text)
+	}
+
+	body := text[1 : len(text)-1]
+	var symbol string
+	switch {
+	case body == "":
+		return "", fmt.Errorf("Empty symbol literal %s", text)
+	case body == `\'` || body == `\\`:
+		symbol = body[1:]
+	case strings.HasPrefix(body, `\u`):
+		code, err := strconv.ParseUint(body[2:], 16, 32)
+		if err != nil || len(body) != 6 {
+			return "", fmt.Errorf("Invalid escape in symbol literal %s, expected \\uXXXX", text)
+		}
+		symbol = string(rune(code))
+	case strings.HasPrefix(body, `\`):
+		return "", fmt.Errorf("Unknown escape in symbol literal %s", text)
+	default:
+		symbol = body
+	}
+
+	char, size := utf8.DecodeRuneInString(symbol)
+	if size != len(symbol) {
+		return "", fmt.Errorf("Symbol literal %s must hold a single character", text)
+	}
+	if char == utf8.RuneError || !unicode.IsGraphic(char) || unicode.IsSpace(char) {
+		return "", fmt.Errorf("Symbol literal %s is not a printable character", text)
+	}
+	return symbol, nil
+}
+
+// QuoteSymbol returns the canonical source form of a tape symbol: bare when
+// the lexer reads it back as a SYMBOL, otherwise a quoted literal.
+func QuoteSymbol(symbol string) string {
+	if len(symbol) == 1 && bareSymbol.MatchString(symbol) && symbol != "L" && symbol != "R" && symbol != "S" {
+		return symbol
+	}
+	switch symbol {
+	case "'", `\`:
+		return `'\` + symbol + `'`
+	}
+	return "'" + symbol + "'"
+}
+
+var bareSymbol = regexp.MustCompile(`^[0-9a-zA-Z_]$`)
@@ -0,0 +1,1049 @@
+package tmlang
+
+import (
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Meta holds the lifecycle states and alphabets declared in the CONFIG section.
+type Meta struct {
+	Start  string
+	Accept string
+	Reject string
+
+	Blank         string   // BLANK: symbol, "" means the default _
+	InputAlphabet []string // INPUT: symbols allowed in the initial input, if declared
+	TapeAlphabet  []string // TAPE: symbols allowed anywhere on the tape, if declared
+}
+
+// BlankSymbol returns the declared blank, or _ when none was declared.
+func (meta Meta) BlankSymbol() string {
+	if meta.Blank == "" {
+		return "_"
+	}
+	return meta.Blank
+}
+
+// InputSymbols returns the symbols an initial input may hold: INPUT when
+// declared, else TAPE and the blank, else nil for any symbol.
+func (meta Meta) InputSymbols() []string {
+	if len(meta.InputAlphabet) > 0 {
+		return meta.InputAlphabet
+	}
+	if len(meta.TapeAlphabet) > 0 {
+		return withBlank(meta.TapeAlphabet, meta.BlankSymbol())
+	}
+	return nil
+}
+
+// IntermediateRepresention is the parsed program before macro expansion.
+type IntermediateRepresention struct {
+	Meta        Meta
+	ConfigSpans map[string]Span // Config key (START:, ...) -> span of its state name
+	Sections    map[string]Span // Section header (CONFIG:, ...) -> span of the header
+
+	Imports []Import
+	Macros  map[string]Macro
+
+	Main []Transition
+
+	Tests []TestCase
+}
+
+// Import is an IMPORT "path" [AS name] line. The imported file's macros are
+// called as <Namespace>.<macro>.
+type Import struct {
+	Path      string // As written, relative to the importing file
+	Namespace string
+	Span      Span // The whole IMPORT line
+	PathSpan  Span
+}
+
+// TestCase is one line of the TESTS section: run Input and check how the
+// machine halts, what it leaves on the tape, or both.
+type TestCase struct {
+	Input    string
+	Expect   string // ACCEPT, REJECT, CRASH or TIMEOUT, "" to check only the tape
+	Tape     string // Expected tape without leading and trailing blanks, if HasTape
+	HasTape  bool
+	MaxSteps int  // From the last MAXSTEPS line before the case, DefaultTestSteps if none
+	Span     Span // The whole line
+}
+
+// expectedStatus maps the verdicts of a TestCase to simulator statuses.
+var expectedStatus = map[string]string{
+	"ACCEPT":  StatusAccepted,
+	"REJECT":  StatusRejected,
+	"CRASH":   StatusCrash,
+	"TIMEOUT": StatusTimeout,
+}
+
+// String returns the case as written in canonical form, "11" -> ACCEPT TAPE "100".
+func (test TestCase) String() string {
+	text := strconv.Quote(test.Input) + " ->"
+	if test.Expect != "" {
+		text += " " + test.Expect
+	}
+	if test.HasTape {
+		text += " TAPE " + strconv.Quote(test.Tape)
+	}
+	return text
+}
+
+// Macro is a DEF block from the MACROS section.
+type Macro struct {
+	Name   string
+	Span   Span // The name in DEF <name>:
+	Params []Param
+	Body   []Transition
+}
+
+// Param is a macro parameter. Its Type is inferred from where the body uses
+// it: SYMBOL in a read or write, DIR as a direction, "" if unused.
+type Param struct {
+	Name string
+	Type string
+	Span Span
+}
+
+// ParamRef is a use of a macro parameter inside a transition.
+type ParamRef struct {
+	Name  string
+	Slot  string // READ, SET, WRITE, DIR or ARG
+	Index int    // Position in ReadSet for SET, in Target.Args for ARG
+	Span  Span
+}
+
+// Argument is one value passed in CALL <macro>(...).
+type Argument struct {
+	Value string // The symbol or direction, or a parameter name passed on
+	Type  string // SYMBOL or DIR, "" for a parameter
+	Span  Span
+}
+
+// Exit binds a labelled RETURN of the called macro to a state | found: q3
+type Exit struct {
+	Label     string
+	State     string
+	LabelSpan Span
+	StateSpan Span
+}
+
+// Target is the right-hand destination of a Transition.
+type Target struct {
+	Type       string // CALL or GOTO or RETURN
+	Name       string // State name, macro name, or the label of RETURN <label>
+	Namespace  string // Prefix added to Name when its macro was IMPORTed, "lib."
+	Return     string // CALL <macro> -> q0         q0 is Return state, for a plain RETURN
+	Exits      []Exit // CALL <macro> -> found: q3, missing: fail
+	Args       []Argument
+	NameSpan   Span // For RETURN, the keyword and its label
+	ReturnSpan Span
+}
+
+// Transition is a single source line of MAIN or a macro body.
+type Transition struct {
+	Src       string
+	Read      string   // The symbol read, when ReadType is SYMBOL
+	ReadType  string   // SYMBOL, ANY (*), SET ({0, 1}) or NOT (!_, !{0, 1})
+	ReadSet   []string // Symbols of a SET or NOT read
+	Write     string
+	WriteSame bool // = writes back the symbol that was read
+	Dir       string
+	Params    []ParamRef // Slots above that hold a parameter name, in macro bodies
+	Target    Target
+	Span      Span // The whole line
+	SrcSpan   Span
+	ReadSpan  Span // The whole read pattern
+	WriteSpan Span
+}
+
+// IsParam reports whether a slot holds a parameter name rather than a value.
+// index is the position in ReadSet or Target.Args, and 0 for other slots.
+func (transition Transition) IsParam(slot string, index int) bool {
+	for _, ref := range transition.Params {
+		if ref.Slot == slot && ref.Index == index {
+			return true
+		}
+	}
+	return false
+}
+
+// ReadText returns the read pattern as it is written in source.
+func (transition Transition) ReadText() string {
+	switch transition.ReadType {
+	case "ANY":
+		return "*"
+	case "SET", "NOT":
+		var symbols []string
+		for i, symbol := range transition.ReadSet {
+			if !transition.IsParam("SET", i) {
+				symbol = QuoteSymbol(symbol)
+			}
+			symbols = append(symbols, symbol)
+		}
+		if transition.ReadType == "NOT" && len(symbols) == 1 {
+			return "!" + symbols[0]
+		}
+		text := "{" + strings.Join(symbols, ", ") + "}"
+		if transition.ReadType == "NOT" {
+			text = "!" + text
+		}
+		return text
+	}
+	if transition.IsParam("READ", 0) {
+		return transition.Read
+	}
+	return QuoteSymbol(transition.Read)
+}
+
+// WriteText returns the written symbol, or = for write-same, as in source.
+func (transition Transition) WriteText() string {
+	switch {
+	case transition.WriteSame:
+		return "="
+	case transition.IsParam("WRITE", 0):
+		return transition.Write
+	}
+	return QuoteSymbol(transition.Write)
+}
+
+// Parser builds an IntermediateRepresention from a token stream.
+// Syntax errors are collected in Diagnostics and parsing resumes on the next line.
+type Parser struct {
+	Tokens       []Token
+	Position     int
+	CurrentToken Token
+	LastToken    Token // Most recently consumed token
+	IR           IntermediateRepresention
+	Diagnostics  Diagnostics
+	Library      bool // Parsing an IMPORTed file: CONFIG and MAIN are optional
+
+	params map[string]bool // Parameters of the macro being parsed, nil in MAIN
+}
+
+func (parser *Parser) InitParser(_tokens []Token) {
+	parser.Tokens = _tokens
+	parser.Position = 0
+	if len(_tokens) > 0 {
+		parser.CurrentToken = parser.Tokens[0]
+	} else {
+		parser.CurrentToken = Token{TypeOfToken: EOF}
+	}
+	parser.LastToken = Token{}
+	parser.IR = IntermediateRepresention{}
+	parser.IR.ConfigSpans = make(map[string]Span)
+	parser.IR.Sections = make(map[string]Span)
+	parser.IR.Macros = make(map[string]Macro)
+	parser.Diagnostics = nil
+	parser.params = nil
+}
+
+func (parser *Parser) advance() {
+	parser.LastToken = parser.CurrentToken
+	parser.Position += 1
+	if parser.Position < len(parser.Tokens) {
+		parser.CurrentToken = parser.Tokens[parser.Position]
+	} else {
+		parser.CurrentToken = Token{TypeOfToken: EOF, Line: parser.LastToken.Line, Column: parser.LastToken.Column, File: parser.LastToken.File}
+	}
+}
+
+func (parser *Parser) atEnd() bool {
+	return parser.CurrentToken.isNil() || parser.CurrentToken.TypeOfToken == EOF
+}
+
+// atSectionEnd reports whether the current section has no more lines. A
+// misplaced IMPORT also ends it, to be reported by Parse.
+func (parser *Parser) atSectionEnd() bool {
+	return parser.atEnd() || parser.CurrentToken.TypeOfToken == SECTION ||
+		parser.CurrentToken.TypeOfToken == KEYWORD && parser.CurrentToken.Value == "IMPORT"
+}
+
+func (parser *Parser) consume(tokenType TokenType) (Token, error) {
+	if !parser.CurrentToken.isNil() && parser.CurrentToken.TypeOfToken == tokenType {
+		token := parser.CurrentToken
+		parser.advance()
+		return token, nil
+	} else {
+		return Token{}, parser.unexpected(string(tokenType))
+	}
+}
+
+func (parser *Parser) unexpected(expected string) Diagnostic {
+	currentTextValue := parser.CurrentToken.Value
+	if parser.atEnd() {
+		currentTextValue = "EOF"
+	}
+
+	return newError(
+		CodeUnexpectedToken,
+		parser.CurrentToken.Span(),
+		"Expected %s but got %s",
+		expected,
+		currentTextValue,
+	)
+}
+
+func (parser *Parser) report(err error) {
+	if diagnostic, ok := err.(Diagnostic); ok {
+		parser.Diagnostics = append(parser.Diagnostics, diagnostic)
+	}
+}
+
+// synchronize skips the rest of the line a failed construct started on,
+// so the next line is parsed from a clean state.
+func (parser *Parser) synchronize(line int) {
+	for !parser.atEnd() && parser.CurrentToken.Line <= line {
+		parser.advance()
+	}
+}
+
+func (parser *Parser) parseConfig() {
+	header, _ := parser.consume(SECTION)
+
+	stateKeys := map[string]*string{
+		"START:":  &parser.IR.Meta.Start,
+		"ACCEPT:": &parser.IR.Meta.Accept,
+		"REJECT:": &parser.IR.Meta.Reject,
+	}
+	alphabetKeys := map[string]*[]string{
+		"INPUT:": &parser.IR.Meta.InputAlphabet,
+		"TAPE:":  &parser.IR.Meta.TapeAlphabet,
+	}
+
+	for !parser.atSectionEnd() {
+		line := parser.CurrentToken.Line
+
+		configKeyword, err := parser.consume(KEYWORD)
+		key := configKeyword.Value
+		if err == nil && stateKeys[key] == nil && alphabetKeys[key] == nil && key != "BLANK:" {
+			err = newError(CodeUnexpectedToken, configKeyword.Span(), "Expected START:, ACCEPT:, REJECT:, BLANK:, INPUT: or TAPE: but got %s", key)
+		}
+		if err != nil {
+			parser.report(err)
+			parser.synchronize(line)
+			continue
+		}
+
+		var values []Token
+		switch {
+		case stateKeys[key] != nil:
+			var configIdentifier Token
+			configIdentifier, err = parser.consume(ID)
+			values = []Token{configIdentifier}
+		case key == "BLANK:":
+			var blankSymbol Token
+			blankSymbol, err = parser.consume(SYMBOL)
+			values = []Token{blankSymbol}
+		default:
+			values, err = parser.parseSymbolList()
+		}
+		if err != nil {
+			parser.report(err)
+			parser.synchronize(line)
+			continue
+		}
+		valueSpan := values[0].Span().To(values[len(values)-1].Span())
+
+		if previous, exists := parser.IR.ConfigSpans[key]; exists {
+			diagnostic := newError(CodeDuplicateConfig, configKeyword.Span(), "%s is already set", key)
+			diagnostic.Related = []Related{{previous, "first set here"}}
+			parser.report(diagnostic)
+			continue
+		}
+		parser.IR.ConfigSpans[key] = valueSpan
+
+		switch {
+		case stateKeys[key] != nil:
+			*stateKeys[key] = values[0].Value
+		case key == "BLANK:":
+			parser.IR.Meta.Blank = symbolValue(values[0])
+		default:
+			seen := make(map[string]bool)
+			for _, token := range values {
+				symbol := symbolValue(token)
+				if seen[symbol] {
+					parser.report(newWarning(CodeDuplicateSymbol, token.Span(), "Symbol %s is listed twice in %s", token.Value, key))
+					continue
+				}
+				seen[symbol] = true
+				*alphabetKeys[key] = append(*alphabetKeys[key], symbol)
+			}
+		}
+	}
+
+	for _, key := range []string{"START:", "ACCEPT:", "REJECT:"} {
+		if _, exists := parser.IR.ConfigSpans[key]; !exists {
+			parser.report(newError(CodeMissingConfig, header.Span(), "CONFIG is missing %s", key))
+		}
+	}
+}
+
+// symbolValue is the tape symbol a SYMBOL token stands for; the lexer has
+// already rejected malformed literals.
+func symbolValue(token Token) string {
+	symbol, _ := UnquoteSymbol(token.Value)
+	return symbol
+}
+
+// consumeSymbol consumes a tape symbol or, inside a macro, the name of one
+// of its parameters, which comes back as an ID token.
+func (parser *Parser) consumeSymbol() (Token, error) {
+	if parser.CurrentToken.TypeOfToken == ID && parser.params[parser.CurrentToken.Value] {
+		token := parser.CurrentToken
+		parser.advance()
+		return token, nil
+	}
+	return parser.consume(SYMBOL)
+}
+
+// parseSymbolList parses a comma separated list of tape symbols | 0, 1, _
+func (parser *Parser) parseSymbolList() ([]Token, error) {
+	var symbols []Token
+	for {
+		symbol, err := parser.consumeSymbol()
+		if err != nil {
+			return nil, err
+		}
+		symbols = append(symbols, symbol)
+
+		if parser.CurrentToken.TypeOfToken != COMMA {
+			return symbols, nil
+		}
+		parser.advance()
+	}
+}
+
+func (parser *Parser) parseMacros() {
+	parser.consume(SECTION) // Move parser to next token after "MACROS:", DEF <name>:
+
+	for !parser.atSectionEnd() {
+		line := parser.CurrentToken.Line
+
+		macroIdentifier, params, err := parser.parseMacroHeader()
+		if err != nil {
+			parser.report(err)
+			parser.synchronize(line)
+		}
+
+		parser.params = make(map[string]bool)
+		for _, param := range params {
+			parser.params[param.Name] = true
+		}
+
+		var transitions []Transition
+		for !parser.atSectionEnd() && parser.CurrentToken.Value != "DEF" {
+			transitionLine := parser.CurrentToken.Line
+			transition, err := parser.parseTransition()
+
+			if err != nil {
+				parser.report(err)
+				parser.synchronize(transitionLine)
+				continue
+			}
+
+			transitions = append(transitions, transition)
+		}
+		parser.params = nil
+
+		if err != nil {
+			continue // Body was still parsed for its own errors
+		}
+		parser.inferParamTypes(params, transitions)
+
+		if previous, exists := parser.IR.Macros[macroIdentifier.Value]; exists {
+			diagnostic := newError(CodeDuplicateMacro, macroIdentifier.Span(), "Macro %s is already defined", macroIdentifier.Value)
+			diagnostic.Related = []Related{{previous.Span, "first defined here"}}
+			parser.report(diagnostic)
+			continue
+		}
+
+		parser.IR.Macros[macroIdentifier.Value] = Macro{
+			Name:   macroIdentifier.Value,
+			Span:   macroIdentifier.Span(),
+			Params: params,
+			Body:   transitions,
+		}
+	}
+}
+
+// parseMacroHeader parses DEF <name>: or DEF <name>(<param>, ...): and
+// returns the name token and the parameters.
+func (parser *Parser) parseMacroHeader() (Token, []Param, error) {
+	if parser.CurrentToken.Value != "DEF" {
+		return Token{}, nil, parser.unexpected("DEF")
+	}
+	parser.advance()
+
+	macroIdentifier, err := parser.consume(ID)
+	if err != nil {
+		return Token{}, nil, err
+	}
+
+	var params []Param
+	if parser.CurrentToken.TypeOfToken == LPAREN {
+		parser.advance()
+		for parser.CurrentToken.TypeOfToken != RPAREN {
+			if len(params) > 0 {
+				if _, err := parser.consume(COMMA); err != nil {
+					return Token{}, nil, err
+				}
+			}
+			name, err := parser.consume(ID)
+			if err != nil {
+				return Token{}, nil, err
+			}
+			if duplicate := findParam(params, name.Value); duplicate != nil {
+				diagnostic := newError(CodeDuplicateParam, name.Span(), "Parameter %s is already declared", name.Value)
+				diagnostic.Related = []Related{{duplicate.Span, "first declared here"}}
+				return Token{}, nil, diagnostic
+			}
+			params = append(params, Param{Name: name.Value, Span: name.Span()})
+		}
+		parser.advance()
+	}
+
+	if _, err := parser.consume(COLON); err != nil {
+		return Token{}, nil, err
+	}
+	return macroIdentifier, params, nil
+}
+
+func findParam(params []Param, name string) *Param {
+	for i := range params {
+		if params[i].Name == name {
+			return &params[i]
+		}
+	}
+	return nil
+}
+
+// inferParamTypes sets each parameter's Type from its uses in the body.
+// A parameter used both as a symbol and as a direction is an error.
+// Parameters only passed on to other CALLs are typed by the analyzer.
+func (parser *Parser) inferParamTypes(params []Param, body []Transition) {
+	for i := range params {
+		param := &params[i]
+		used := false
+		var first ParamRef
+		for _, transition := range body {
+			for _, ref := range transition.Params {
+				if ref.Name != param.Name {
+					continue
+				}
+				used = true
+				if ref.Slot == "ARG" {
+					continue
+				}
+				refType := "SYMBOL"
+				if ref.Slot == "DIR" {
+					refType = "DIR"
+				}
+				switch param.Type {
+				case "":
+					param.Type, first = refType, ref
+				case refType:
+				default:
+					diagnostic := newError(CodeParamType, ref.Span, "Parameter %s is used both as a symbol and as a direction", param.Name)
+					diagnostic.Related = []Related{{first.Span, "first used here"}}
+					parser.report(diagnostic)
+				}
+			}
+		}
+		if !used {
+			parser.report(newWarning(CodeUnusedParam, param.Span, "Parameter %s is never used", param.Name))
+		}
+	}
+}
+
+// parseImport parses IMPORT "lib.tm" or IMPORT "lib.tm" AS name. Without AS
+// the namespace is the file name without its extension.
+func (parser *Parser) parseImport() error {
+	keyword, _ := parser.consume(KEYWORD)
+	path, err := parser.consume(STRING)
+	if err != nil {
+		return err
+	}
+
+	imp := Import{Path: strings.Trim(path.Value, `"`), PathSpan: path.Span()}
+	if imp.Path == "" {
+		return newError(CodeImportError, path.Span(), "IMPORT needs a file path")
+	}
+	if parser.CurrentToken.TypeOfToken == KEYWORD && parser.CurrentToken.Value == "AS" {
+		parser.advance()
+		name, err := parser.consume(ID)
+		if err != nil {
+			return err
+		}
+		imp.Namespace = name.Value
+	} else {
+		base := filepath.Base(strings.TrimPrefix(imp.Path, stdPrefix))
+		imp.Namespace = strings.TrimSuffix(base, filepath.Ext(base))
+		if !isIdentifier(imp.Namespace) {
+			return newError(CodeImportError, path.Span(), "%s is not a valid namespace; name it with IMPORT %s AS <name>", imp.Namespace, path.Value)
+		}
+	}
+	imp.Span = keyword.Span().To(parser.LastToken.Span())
+
+	if parser.CurrentToken.Line == keyword.Line && !parser.atEnd() {
+		return parser.unexpected("end of line")
+	}
+
+	for _, previous := range parser.IR.Imports {
+		if previous.Namespace == imp.Namespace {
+			diagnostic := newError(CodeDuplicateImport, imp.Span, "Namespace %s is already imported", imp.Namespace)
+			diagnostic.Related = []Related{{previous.Span, "first imported here"}}
+			return diagnostic
+		}
+	}
+	parser.IR.Imports = append(parser.IR.Imports, imp)
+	return nil
+}
+
+// isIdentifier reports whether name lexes as a single ID token.
+func isIdentifier(name string) bool {
+	var lexer Lexer
+	lexer.InitLexer(name)
+	tokens := lexer.TokenizeSource()
+	return len(lexer.Diagnostics) == 0 && len(tokens) == 2 && tokens[0].TypeOfToken == ID && tokens[0].Value == name
+}
+
+// parseMacroName parses a macro name in CALL, qualified with the namespaces
+// of IMPORTs: move_end, lib.move_end or lib.util.move_end.
+func (parser *Parser) parseMacroName() (string, Span, error) {
+	first, err := parser.consume(ID)
+	if err != nil {
+		return "", Span{}, err
+	}
+	name, span := first.Value, first.Span()
+	for parser.CurrentToken.TypeOfToken == DOT {
+		parser.advance()
+		part, err := parser.consume(ID)
+		if err != nil {
+			return "", Span{}, err
+		}
+		name += "." + part.Value
+		span = span.To(part.Span())
+	}
+	return name, span, nil
+}
+
+func (parser *Parser) parseMain() {
+	parser.consume(SECTION)
+
+	for !parser.atSectionEnd() {
+		line := parser.CurrentToken.Line
+		transtion, err := parser.parseTransition()
+		if err != nil {
+			parser.report(err)
+			parser.synchronize(line)
+			continue
+		}
+		parser.IR.Main = append(parser.IR.Main, transtion)
+	}
+}
+
+func (parser *Parser) parseTransition() (Transition, error) { // Parses main and macros transitions | q0, 1 -> 1, R, q0 or q0, * -> =, R, q0
+
+	srcIdentifier, err := parser.consume(ID)
+	if err != nil {
+		return Transition{}, err
+
+	}
+
+	if _, err := parser.consume(COMMA); err != nil {
+		return Transition{}, err
+
+	}
+
+	readStart := parser.CurrentToken
+	read, err := parser.parseRead()
+	if err != nil {
+		return Transition{}, err
+
+	}
+	read.ReadSpan = readStart.Span().To(parser.LastToken.Span())
+
+	if _, err := parser.consume(ARROW); err != nil {
+		return Transition{}, err
+
+	}
+
+	var writeSymbol Token
+	if parser.CurrentToken.TypeOfToken == SAME {
+		writeSymbol, _ = parser.consume(SAME)
+		read.WriteSame = true
+	} else {
+		writeSymbol, err = parser.consumeSymbol()
+		if err != nil {
+			return Transition{}, err
+		}
+		read.Write = symbolValue(writeSymbol)
+		if writeSymbol.TypeOfToken == ID {
+			read.Params = append(read.Params, ParamRef{writeSymbol.Value, "WRITE", 0, writeSymbol.Span()})
+		}
+	}
+
+	if _, err := parser.consume(COMMA); err != nil {
+		return Transition{}, err
+
+	}
+
+	var direction Token
+	if parser.CurrentToken.TypeOfToken == ID && parser.params[parser.CurrentToken.Value] {
+		direction, _ = parser.consume(ID)
+		read.Params = append(read.Params, ParamRef{direction.Value, "DIR", 0, direction.Span()})
+	} else if direction, err = parser.consume(DIRECTION); err != nil {
+		return Transition{}, err
+
+	}
+	if _, err := parser.consume(COMMA); err != nil {
+		return Transition{}, err
+
+	}
+
+	var target Target
+
+	if parser.CurrentToken.TypeOfToken == KEYWORD { // CALL Keyword
+
+		kw, _ := parser.consume(KEYWORD)
+		switch kw.Value {
+		case "CALL":
+			macroName, macroSpan, err := parser.parseMacroName() // CALL move_to_end -> q1 or CALL seek(_, R) -> q1
+
+			if err != nil {
+				return Transition{}, err
+
+			}
+
+			if parser.CurrentToken.TypeOfToken == LPAREN {
+				var refs []ParamRef
+				if target.Args, refs, err = parser.parseArguments(); err != nil {
+					return Transition{}, err
+				}
+				read.Params = append(read.Params, refs...)
+			}
+
+			if _, err := parser.consume(ARROW); err != nil {
+				return Transition{}, err
+
+			}
+			if err := parser.parseExits(&target); err != nil {
+				return Transition{}, err
+			}
+
+			target.Type = "CALL"
+			target.Name = macroName
+			target.NameSpan = macroSpan
+
+		case "RETURN":
+			target.Type = "RETURN"
+			target.NameSpan = kw.Span()
+			if label := parser.CurrentToken; label.TypeOfToken == ID && label.Line == kw.Line { // RETURN found
+				parser.advance()
+				target.Name = label.Value
+				target.NameSpan = kw.Span().To(label.Span())
+			}
+		default:
+			return Transition{}, newError(CodeUnexpectedToken, kw.Span(), "Expected CALL, RETURN or a state but got %s", kw.Value)
+		}
+	} else { // regular, q0, 0 -> 0, q1
+		returnStateIdentifier, err := parser.consume(ID)
+
+		if err != nil {
+			return Transition{}, err
+
+		}
+
+		target.Type = "GOTO"
+		target.Name = returnStateIdentifier.Value
+		target.NameSpan = returnStateIdentifier.Span()
+	}
+
+	transition := read // Read pattern and write were filled in above
+	transition.Src = srcIdentifier.Value
+	transition.Dir = direction.Value
+	transition.Target = target
+	transition.Span = srcIdentifier.Span().To(parser.LastToken.Span())
+	transition.SrcSpan = srcIdentifier.Span()
+	transition.WriteSpan = writeSymbol.Span()
+	return transition, nil
+
+}
+
+// parseRead parses the read column | 0, *, {0, 1}, !_, !{0, 1}
+// It returns a Transition with only the read fields set.
+func (parser *Parser) parseRead() (Transition, error) {
+	var read Transition
+
+	switch parser.CurrentToken.TypeOfToken {
+	case WILDCARD:
+		parser.advance()
+		read.ReadType = "ANY"
+		return read, nil
+	case NOT:
+		parser.advance()
+		read.ReadType = "NOT"
+	default:
+		read.ReadType = "SET"
+	}
+
+	if parser.CurrentToken.TypeOfToken != LBRACE {
+		symbol, err := parser.consumeSymbol()
+		if err != nil {
+			return Transition{}, err
+		}
+		slot := "SET"
+		if read.ReadType == "SET" { // A plain symbol
+			read.ReadType = "SYMBOL"
+			read.Read = symbolValue(symbol)
+			slot = "READ"
+		} else {
+			read.ReadSet = []string{symbolValue(symbol)}
+		}
+		if symbol.TypeOfToken == ID {
+			read.Params = append(read.Params, ParamRef{symbol.Value, slot, 0, symbol.Span()})
+		}
+		return read, nil
+	}
+
+	parser.advance()
+	symbols, err := parser.parseSymbolList()
+	if err != nil {
+		return Transition{}, err
+	}
+	if _, err := parser.consume(RBRACE); err != nil {
+		return Transition{}, err
+	}
+
+	seen := make(map[string]bool)
+	for _, token := range symbols {
+		symbol := symbolValue(token)
+		if seen[symbol] {
+			parser.report(newWarning(CodeDuplicateSymbol, token.Span(), "Symbol %s is listed twice in the set", token.Value))
+			continue
+		}
+		seen[symbol] = true
+		if token.TypeOfToken == ID {
+			read.Params = append(read.Params, ParamRef{token.Value, "SET", len(read.ReadSet), token.Span()})
+		}
+		read.ReadSet = append(read.ReadSet, symbol)
+	}
+	return read, nil
+}
+
+// parseExits parses the states a CALL returns to | q1 or found: q3, missing: fail
+// An unlabelled state is where a plain RETURN goes.
+func (parser *Parser) parseExits(target *Target) error {
+	for {
+		state, err := parser.consume(ID)
+		if err != nil {
+			return err
+		}
+
+		if parser.CurrentToken.TypeOfToken == COLON {
+			parser.advance()
+			label := state
+			if state, err = parser.consume(ID); err != nil {
+				return err
+			}
+			for _, exit := range target.Exits {
+				if exit.Label == label.Value {
+					diagnostic := newError(CodeDuplicateExit, label.Span(), "Exit %s is already bound", label.Value)
+					diagnostic.Related = []Related{{exit.LabelSpan, "first bound here"}}
+					return diagnostic
+				}
+			}
+			target.Exits = append(target.Exits, Exit{label.Value, state.Value, label.Span(), state.Span()})
+		} else if target.Return != "" {
+			diagnostic := newError(CodeDuplicateExit, state.Span(), "CALL already returns to %s; label the other exits as <label>: <state>", target.Return)
+			diagnostic.Related = []Related{{target.ReturnSpan, "plain RETURN bound here"}}
+			return diagnostic
+		} else {
+			target.Return = state.Value
+			target.ReturnSpan = state.Span()
+		}
+
+		if parser.CurrentToken.TypeOfToken != COMMA {
+			return nil
+		}
+		parser.advance()
+	}
+}
+
+// parseArguments parses the arguments of a CALL | (_, R)
+// Inside a macro an argument can pass on one of its parameters.
+func (parser *Parser) parseArguments() ([]Argument, []ParamRef, error) {
+	parser.advance()
+
+	args := []Argument{}
+	var refs []ParamRef
+	for parser.CurrentToken.TypeOfToken != RPAREN {
+		if len(args) > 0 {
+			if _, err := parser.consume(COMMA); err != nil {
+				return nil, nil, err
+			}
+		}
+		switch token := parser.CurrentToken; {
+		case token.TypeOfToken == SYMBOL:
+			args = append(args, Argument{symbolValue(token), "SYMBOL", token.Span()})
+		case token.TypeOfToken == DIRECTION:
+			args = append(args, Argument{token.Value, "DIR", token.Span()})
+		case token.TypeOfToken == ID && parser.params[token.Value]:
+			refs = append(refs, ParamRef{token.Value, "ARG", len(args), token.Span()})
+			args = append(args, Argument{token.Value, "", token.Span()})
+		default:
+			return nil, nil, parser.unexpected("a symbol or direction")
+		}
+		parser.advance()
+	}
+	parser.advance()
+	return args, refs, nil
+}
+
+// parseTests parses the TESTS section: one "input" -> expectation case per
+// line, and MAXSTEPS n lines setting the step limit of the cases after them.
+func (parser *Parser) parseTests() {
+	parser.consume(SECTION)
+	maxSteps := DefaultTestSteps
+
+	for !parser.atSectionEnd() {
+		line := parser.CurrentToken.Line
+		var err error
+		if parser.CurrentToken.TypeOfToken == ID && parser.CurrentToken.Value == "MAXSTEPS" {
+			parser.advance()
+			maxSteps, err = parser.parseCount()
+		} else {
+			var test TestCase
+			test, err = parser.parseTestCase()
+			test.MaxSteps = maxSteps
+			if err == nil {
+				parser.IR.Tests = append(parser.IR.Tests, test)
+			}
+		}
+		if err == nil && parser.CurrentToken.Line == line && !parser.atEnd() {
+			err = parser.unexpected("end of line")
+		}
+		if err != nil {
+			parser.report(err)
+			parser.synchronize(line)
+		}
+	}
+}
+
+// parseTestCase parses "input" -> [ACCEPT | REJECT | CRASH | TIMEOUT] [TAPE "tape"],
+// with at least one of the two expectations.
+func (parser *Parser) parseTestCase() (TestCase, error) {
+	input, err := parser.consume(STRING)
+	if err != nil {
+		return TestCase{}, err
+	}
+	if _, err := parser.consume(ARROW); err != nil {
+		return TestCase{}, err
+	}
+
+	test := TestCase{Input: strings.Trim(input.Value, `"`)}
+	if _, exists := expectedStatus[parser.CurrentToken.Value]; exists && parser.CurrentToken.TypeOfToken == ID {
+		test.Expect = parser.CurrentToken.Value
+		parser.advance()
+	}
+	if parser.CurrentToken.TypeOfToken == ID && parser.CurrentToken.Value == "TAPE" {
+		parser.advance()
+		tape, err := parser.consume(STRING)
+		if err != nil {
+			return TestCase{}, err
+		}
+		test.Tape, test.HasTape = strings.Trim(tape.Value, `"`), true
+	}
+	if test.Expect == "" && !test.HasTape {
+		return TestCase{}, parser.unexpected("ACCEPT, REJECT, CRASH, TIMEOUT or TAPE")
+	}
+	test.Span = input.Span().To(parser.LastToken.Span())
+	return test, nil
+}
+
+// parseCount parses a positive whole number, which lexes as a NUMBER or,
+// for a single digit, a SYMBOL.
+func (parser *Parser) parseCount() (int, error) {
+	token := parser.CurrentToken
+	if token.TypeOfToken != NUMBER && (token.TypeOfToken != SYMBOL || token.Value < "0" || token.Value > "9") {
+		return 0, parser.unexpected("a number")
+	}
+	parser.advance()
+	count, err := strconv.Atoi(token.Value)
+	if err != nil || count <= 0 {
+		return 0, newError(CodeUnexpectedToken, token.Span(), "Expected a positive number but got %s", token.Value)
+	}
+	return count, nil
+}
+
+// Parse consumes the CONFIG, optional MACROS, MAIN and optional TESTS
+// sections in order.
+// Every syntax error in the file is reported; the returned error is the
+// list of error Diagnostics, or nil.
+func (parser *Parser) Parse() (IntermediateRepresention, error) {
+
+	sectionOrder := map[string]int{"CONFIG:": 0, "MACROS:": 1, "MAIN:": 2, "TESTS:": 3}
+	seen := parser.IR.Sections
+	lastSection := ""
+
+	for !parser.atEnd() {
+		if parser.CurrentToken.TypeOfToken == KEYWORD && parser.CurrentToken.Value == "IMPORT" {
+			line := parser.CurrentToken.Line
+			if lastSection != "" {
+				parser.report(newError(CodeSectionOrder, parser.CurrentToken.Span(), "IMPORT must come before %s", lastSection))
+			}
+			if err := parser.parseImport(); err != nil {
+				parser.report(err)
+				parser.synchronize(line)
+			}
+			continue
+		}
+		if parser.CurrentToken.TypeOfToken != SECTION {
+			parser.report(parser.unexpected("a section header"))
+			parser.synchronize(parser.CurrentToken.Line)
+			continue
+		}
+
+		section := parser.CurrentToken
+		if previous, exists := seen[section.Value]; exists {
+			diagnostic := newError(CodeDuplicateSection, section.Span(), "Section %s appears more than once", section.Value)
+			diagnostic.Related = []Related{{previous, "first appears here"}}
+			parser.report(diagnostic)
+		} else if lastSection != "" && sectionOrder[section.Value] < sectionOrder[lastSection] {
+			parser.report(newError(CodeSectionOrder, section.Span(), "Section %s must come before %s", section.Value, lastSection))
+		}
+		if _, exists := seen[section.Value]; !exists {
+			seen[section.Value] = section.Span()
+		}
+		lastSection = section.Value
+
+		switch section.Value {
+		case "CONFIG:":
+			parser.parseConfig()
+		case "MACROS:": // Macros are optinal
+			parser.parseMacros()
+		case "MAIN:":
+			parser.parseMain()
+		case "TESTS:": // Tests are optional
+			parser.parseTests()
+		}
+	}
+
+	fileStart := Span{Start: Position{1, 1}, End: Position{1, 1}}
+	if parser.Library {
+		// An imported file only contributes macros
+	} else if _, exists := seen["CONFIG:"]; !exists {
+		parser.report(newError(CodeMissingSection, fileStart, "Program must contain a CONFIG section"))
+	}
+	if _, exists := seen["MAIN:"]; !exists && !parser.Library {
+		parser.report(newError(CodeMissingSection, fileStart, "Program must contain a MAIN section"))
+	}
+
+	if errs := parser.Diagnostics.Errors(); len(errs) > 0 {
+		return parser.IR, errs
+	}
+	return parser.IR, nil
+}
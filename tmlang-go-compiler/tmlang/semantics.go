@@ -0,0 +1,869 @@
+package tmlang
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// FlatTransition is a fully expanded rule: in state Src reading Read,
+// write Write, move Dir and go to Next.
+type FlatTransition struct {
+	Src   string
+	Read  string
+	Write string
+	Dir   string
+	Next  string
+
+	SrcName string     // Src as written in the source, q0 for move_end_1_q0
+	Span    Span       // Source line the rule was written on
+	Calls   []CallSite // CALLs it was expanded through, outermost first
+}
+
+// CallSite is one macro CALL on the path that produced a FlatTransition.
+type CallSite struct {
+	Macro string
+	Span  Span // The macro name in CALL <macro>
+}
+
+// Limits bound macro expansion, so that deep or wide CALL trees fail with a
+// diagnostic instead of exhausting memory. Zero selects the default.
+type Limits struct {
+	MaxDepth       int // Nested CALLs below MAIN, default 32
+	MaxTransitions int // Flat rules after expansion, default 100000
+}
+
+const (
+	defaultMaxDepth       = 32
+	defaultMaxTransitions = 100000
+)
+
+// SemanticAnalyzer expands read patterns and macro calls into a flat
+// transition table.
+type SemanticAnalyzer struct {
+	IR           IntermediateRepresention
+	FinalIR      []FlatTransition
+	MacroCounter int
+	Diagnostics  Diagnostics
+	Limits       Limits
+
+	Alphabet   []string                  // Symbols that read patterns expand over
+	mainPairs  [][]symbolPair            // Concrete reads and writes of each MAIN line
+	macroPairs map[string][][]symbolPair // The same for each macro body line, by instanceKey
+	recursive  map[string]bool           // Macros on a CALL cycle, never expanded
+	exhausted  bool                      // MaxTransitions was reached
+}
+
+// symbolPair is one concrete read and write of a Transition.
+type symbolPair struct {
+	Read, Write string
+}
+
+func (analyzer *SemanticAnalyzer) InitSemanticAnalyzer(_IR IntermediateRepresention) {
+	analyzer.IR = _IR
+	analyzer.FinalIR = make([]FlatTransition, 0)
+	analyzer.MacroCounter = 0
+	analyzer.Diagnostics = nil
+	analyzer.Alphabet = nil
+	analyzer.mainPairs = nil
+	analyzer.macroPairs = make(map[string][][]symbolPair)
+	analyzer.recursive = make(map[string]bool)
+	analyzer.exhausted = false
+	if analyzer.Limits.MaxDepth <= 0 {
+		analyzer.Limits.MaxDepth = defaultMaxDepth
+	}
+	if analyzer.Limits.MaxTransitions <= 0 {
+		analyzer.Limits.MaxTransitions = defaultMaxTransitions
+	}
+}
+
+// Analyze validates the program and returns the flattened transitions.
+// All semantic errors are collected; the returned error lists them, or is nil.
+func (analyzer *SemanticAnalyzer) Analyze() ([]FlatTransition, error) {
+
+	start := analyzer.IR.Meta.Start
+
+	if start == "" {
+		analyzer.report(newError(CodeMissingConfig, Span{}, "No START found in Config"))
+	}
+
+	var macroNames []string
+	for name := range analyzer.IR.Macros {
+		macroNames = append(macroNames, name)
+	}
+	sort.Strings(macroNames)
+
+	for _, name := range macroNames {
+		macro := analyzer.IR.Macros[name]
+		if len(macro.Body) == 0 {
+			analyzer.report(newError(CodeEmptyMacro, macro.Span, "Macro %s has no transitions", macro.Name))
+		}
+	}
+
+	analyzer.checkRecursion(macroNames)
+	analyzer.inferPassedParams(macroNames)
+
+	// Imported macros the program never calls take no part from here on
+	macroNames = analyzer.usedMacros(macroNames)
+	analyzer.checkAlphabet(macroNames)
+
+	analyzer.Alphabet = analyzer.patternAlphabet(macroNames)
+	analyzer.checkInferredAlphabet(macroNames)
+	for _, name := range macroNames {
+		if macro := analyzer.IR.Macros[name]; len(macro.Params) == 0 { // Others are expanded per call
+			analyzer.macroPairs[instanceKey(name, nil)] = analyzer.expandReads(macro.Body)
+		}
+	}
+	analyzer.mainPairs = analyzer.expandReads(analyzer.IR.Main)
+
+	for i, transiton := range analyzer.IR.Main {
+		if err := analyzer.processTransition(transiton, analyzer.mainPairs[i]); err != nil {
+			analyzer.report(err)
+		}
+		if analyzer.exhausted {
+			break
+		}
+	}
+
+	analyzer.checkDeterminism()
+
+	if errs := analyzer.Diagnostics.Errors(); len(errs) > 0 {
+		return analyzer.FinalIR, errs
+	}
+	return analyzer.FinalIR, nil
+}
+
+// report records err, once: a macro expanded several times would otherwise
+// repeat the same diagnostic for every instance.
+func (analyzer *SemanticAnalyzer) report(err error) {
+	diagnostic, ok := err.(Diagnostic)
+	if !ok {
+		return
+	}
+	for _, existing := range analyzer.Diagnostics {
+		if existing.Code == diagnostic.Code && existing.Span == diagnostic.Span && existing.Message == diagnostic.Message {
+			return
+		}
+	}
+	analyzer.Diagnostics = append(analyzer.Diagnostics, diagnostic)
+}
+
+func (analyzer *SemanticAnalyzer) undefinedMacro(target Target) Diagnostic {
+	// Inside an IMPORTed macro, names are reported as written in its file
+	written := strings.TrimPrefix(target.Name, target.Namespace)
+	diagnostic := newError(CodeUndefinedMacro, target.NameSpan, "Call to undefined macro, %s", written)
+
+	var names []string
+	for name := range analyzer.IR.Macros {
+		if local, ok := strings.CutPrefix(name, target.Namespace); ok {
+			names = append(names, local)
+		}
+	}
+	sort.Strings(names)
+
+	if suggestion, ok := closestName(written, names); ok {
+		diagnostic.Fix = &Fix{
+			Message:     fmt.Sprintf("Did you mean %s?", suggestion),
+			Span:        target.NameSpan,
+			Replacement: suggestion,
+		}
+	}
+	return diagnostic
+}
+
+// processTransition appends the flat rules for one MAIN line, one per
+// concrete read in pairs.
+func (analyzer *SemanticAnalyzer) processTransition(transition Transition, pairs []symbolPair) error {
+
+	target := transition.Target
+
+	switch target.Type {
+	case "GOTO":
+		analyzer.emit(transition, pairs, transition.Src, target.Name, nil)
+	case "RETURN":
+		return newError(CodeReturnOutsideMacro, target.NameSpan, "RETURN can only be used inside a macro")
+	case "CALL":
+		return analyzer.expandCall(transition, pairs, transition.Src, callExits(target, ""), nil)
+	}
+
+	return nil
+}
+
+// emit appends one flat rule per pair, from src to next.
+func (analyzer *SemanticAnalyzer) emit(transition Transition, pairs []symbolPair, src, next string, calls []CallSite) {
+	for _, pair := range pairs {
+		analyzer.FinalIR = append(analyzer.FinalIR, FlatTransition{
+			Src:   src,
+			Read:  pair.Read,
+			Write: pair.Write,
+			Dir:   transition.Dir,
+			Next:  next,
+
+			SrcName: transition.Src,
+			Span:    transition.Span,
+			Calls:   calls,
+		})
+	}
+}
+
+// expandCall appends the rules of a CALL line: its entry rules from src, which
+// the caller has already renamed, and a fresh instance of the macro body whose
+// RETURNs go to the state exits binds to their label. calls is the chain of
+// CALLs the line itself was expanded through. Nested CALLs in the body are
+// expanded the same way, each instance with its own state prefix.
+func (analyzer *SemanticAnalyzer) expandCall(transition Transition, pairs []symbolPair, src string, exits map[string]string, calls []CallSite) error {
+	target := transition.Target
+	macroName := target.Name
+
+	macro, exists := analyzer.IR.Macros[macroName]
+	if !exists {
+		return analyzer.undefinedMacro(target)
+	}
+	if len(macro.Body) == 0 || analyzer.recursive[macroName] {
+		return nil // Reported once by Analyze
+	}
+	checks := append(analyzer.checkArguments(macro, target), analyzer.checkExits(macro, target)...)
+	for _, diagnostic := range checks {
+		analyzer.report(diagnostic)
+	}
+	if checks.HasErrors() {
+		return nil
+	}
+
+	innerCalls := append(append([]CallSite{}, calls...), CallSite{Macro: macroName, Span: target.NameSpan})
+	if len(innerCalls) > analyzer.Limits.MaxDepth {
+		diagnostic := newError(CodeExpansionLimit, target.NameSpan, "CALL %s is nested more than %d deep", macroName, analyzer.Limits.MaxDepth)
+		diagnostic.Related = callChain(calls)
+		return diagnostic
+	}
+
+	macroTranstions := instantiate(macro, target.Args)
+	key := instanceKey(macroName, target.Args)
+	if analyzer.macroPairs[key] == nil {
+		analyzer.macroPairs[key] = analyzer.expandReads(macroTranstions)
+	}
+
+	analyzer.MacroCounter++
+	prefix := fmt.Sprintf("%s_%d_", macroName, analyzer.MacroCounter) // For the states in the macro
+
+	macroStart := macroTranstions[0].Src
+	macroStartRenamed := prefix + macroStart // this will be the new start
+
+	analyzer.emit(transition, pairs, src, macroStartRenamed, calls) // Every read enters the same instance
+
+	for i, macroTransition := range macroTranstions {
+		newSrc := prefix + macroTransition.Src
+		macroPairs := analyzer.macroPairs[key][i]
+
+		macroTransactionTarget := macroTransition.Target
+
+		switch macroTransactionTarget.Type {
+		case "GOTO":
+			analyzer.emit(macroTransition, macroPairs, newSrc, prefix+macroTransactionTarget.Name, innerCalls)
+		case "RETURN":
+			analyzer.emit(macroTransition, macroPairs, newSrc, exits[macroTransactionTarget.Name], innerCalls)
+		case "CALL":
+			if err := analyzer.expandCall(macroTransition, macroPairs, newSrc, callExits(macroTransactionTarget, prefix), innerCalls); err != nil {
+				analyzer.report(err)
+			}
+		}
+
+		if len(analyzer.FinalIR) > analyzer.Limits.MaxTransitions {
+			if !analyzer.exhausted {
+				analyzer.exhausted = true
+				diagnostic := newError(CodeExpansionLimit, target.NameSpan, "Macro expansion produced more than %d rules", analyzer.Limits.MaxTransitions)
+				diagnostic.Related = callChain(calls)
+				analyzer.report(diagnostic)
+			}
+			return nil
+		}
+	}
+
+	return nil
+}
+
+// callExits maps each exit label of a CALL, "" for a plain RETURN, to the
+// state it returns to, renamed with prefix.
+func callExits(target Target, prefix string) map[string]string {
+	exits := make(map[string]string)
+	if target.Return != "" {
+		exits[""] = prefix + target.Return
+	}
+	for _, exit := range target.Exits {
+		exits[exit.Label] = prefix + exit.State
+	}
+	return exits
+}
+
+// checkExits reports exits the macro RETURNs through that the CALL does not
+// bind, which are errors, and bindings for exits it never uses.
+func (analyzer *SemanticAnalyzer) checkExits(macro Macro, target Target) Diagnostics {
+	used := make(map[string]Span) // Label -> first RETURN through it
+	var labels []string
+	for _, transition := range macro.Body {
+		if transition.Target.Type != "RETURN" {
+			continue
+		}
+		if _, exists := used[transition.Target.Name]; !exists {
+			used[transition.Target.Name] = transition.Target.NameSpan
+			labels = append(labels, transition.Target.Name)
+		}
+	}
+
+	var named []string // Candidates for a misspelt label
+	for _, label := range labels {
+		if label != "" {
+			named = append(named, label)
+		}
+	}
+
+	var diagnostics Diagnostics
+	bound := callExits(target, "")
+	for _, label := range labels {
+		if _, exists := bound[label]; exists {
+			continue
+		}
+		var diagnostic Diagnostic
+		if label == "" {
+			diagnostic = newError(CodeUnboundExit, target.NameSpan, "CALL %s does not give a state for its plain RETURN", macro.Name)
+		} else {
+			diagnostic = newError(CodeUnboundExit, target.NameSpan, "CALL %s does not bind exit %s", macro.Name, label)
+		}
+		diagnostic.Related = []Related{{used[label], "macro returns through it here"}}
+		diagnostics = append(diagnostics, diagnostic)
+	}
+
+	if _, exists := used[""]; !exists && target.Return != "" {
+		diagnostics = append(diagnostics, newWarning(CodeUnknownExit, target.ReturnSpan, "Macro %s has no plain RETURN, so %s is never reached from it", macro.Name, target.Return))
+	}
+	for _, exit := range target.Exits {
+		if _, exists := used[exit.Label]; exists {
+			continue
+		}
+		diagnostic := newWarning(CodeUnknownExit, exit.LabelSpan, "Macro %s has no exit %s", macro.Name, exit.Label)
+		if suggestion, ok := closestName(exit.Label, named); ok {
+			diagnostic.Fix = &Fix{
+				Message:     fmt.Sprintf("Did you mean %s?", suggestion),
+				Span:        exit.LabelSpan,
+				Replacement: suggestion,
+			}
+		}
+		diagnostics = append(diagnostics, diagnostic)
+	}
+	return diagnostics
+}
+
+// usedMacros filters out IMPORTed macros that no CALL of the program reaches,
+// so a library's symbols only count when it is used. Local macros are kept.
+func (analyzer *SemanticAnalyzer) usedMacros(macroNames []string) []string {
+	used := make(map[string]bool)
+	var visit func(body []Transition)
+	visit = func(body []Transition) {
+		for _, transition := range body {
+			name := transition.Target.Name
+			if macro, exists := analyzer.IR.Macros[name]; transition.Target.Type == "CALL" && exists && !used[name] {
+				used[name] = true
+				visit(macro.Body)
+			}
+		}
+	}
+	visit(analyzer.IR.Main)
+	for _, name := range macroNames {
+		if macro := analyzer.IR.Macros[name]; macro.Span.File == "" {
+			visit(macro.Body)
+		}
+	}
+
+	var kept []string
+	for _, name := range macroNames {
+		if used[name] || analyzer.IR.Macros[name].Span.File == "" {
+			kept = append(kept, name)
+		}
+	}
+	return kept
+}
+
+// checkRecursion reports every cycle of macros that CALL each other, once,
+// at the CALL that closes it. Macros on a cycle are never expanded.
+func (analyzer *SemanticAnalyzer) checkRecursion(macroNames []string) {
+	calls := make(map[string][]callEdge)
+	for _, name := range macroNames {
+		for _, transition := range analyzer.IR.Macros[name].Body {
+			if transition.Target.Type == "CALL" {
+				calls[name] = append(calls[name], callEdge{transition.Target.Name, transition.Target.NameSpan})
+			}
+		}
+	}
+
+	const (
+		unvisited = iota
+		onStack
+		done
+	)
+	state := make(map[string]int)
+	var stack []string
+	var path []callEdge // path[i] is the CALL from stack[i] to stack[i+1]
+	reported := make(map[string]bool)
+
+	var visit func(name string)
+	visit = func(name string) {
+		state[name] = onStack
+		stack = append(stack, name)
+		for _, call := range calls[name] {
+			path = append(path, call)
+			switch state[call.Callee] {
+			case unvisited:
+				if _, exists := analyzer.IR.Macros[call.Callee]; exists {
+					visit(call.Callee)
+				}
+			case onStack:
+				start := len(stack) - 1
+				for stack[start] != call.Callee {
+					start--
+				}
+				analyzer.reportCycle(stack[start:], path[start:], reported)
+			}
+			path = path[:len(path)-1]
+		}
+		stack = stack[:len(stack)-1]
+		state[name] = done
+	}
+
+	for _, name := range macroNames {
+		if state[name] == unvisited {
+			visit(name)
+		}
+	}
+}
+
+// callEdge is a CALL from one macro body to Callee.
+type callEdge struct {
+	Callee string
+	Span   Span
+}
+
+// reportCycle reports one CALL cycle; edges[i] is the CALL made by cycle[i].
+func (analyzer *SemanticAnalyzer) reportCycle(cycle []string, edges []callEdge, reported map[string]bool) {
+	members := append([]string{}, cycle...)
+	sort.Strings(members)
+	key := strings.Join(members, " ")
+	for _, name := range cycle {
+		analyzer.recursive[name] = true
+	}
+	if reported[key] {
+		return
+	}
+	reported[key] = true
+
+	chain := append(append([]string{}, cycle...), cycle[0])
+	last := edges[len(edges)-1]
+	diagnostic := newError(CodeRecursiveMacro, last.Span, "Recursive macro calls: %s", strings.Join(chain, " -> "))
+	for i, call := range edges[:len(edges)-1] {
+		diagnostic.Related = append(diagnostic.Related, Related{call.Span, fmt.Sprintf("%s calls %s here", cycle[i], call.Callee)})
+	}
+	analyzer.report(diagnostic)
+}
+
+// inferPassedParams types the parameters that a macro only passes on to other
+// CALLs, from the parameters they are passed to.
+func (analyzer *SemanticAnalyzer) inferPassedParams(macroNames []string) {
+	reported := make(map[Span]bool)
+	for changed := true; changed; {
+		changed = false
+		for _, name := range macroNames {
+			macro := analyzer.IR.Macros[name]
+			for _, transition := range macro.Body {
+				callee, exists := analyzer.IR.Macros[transition.Target.Name]
+				if transition.Target.Type != "CALL" || !exists {
+					continue
+				}
+				for _, ref := range transition.Params {
+					if ref.Slot != "ARG" || ref.Index >= len(callee.Params) {
+						continue
+					}
+					param, calleeType := findParam(macro.Params, ref.Name), callee.Params[ref.Index].Type
+					switch {
+					case calleeType == "" || param.Type == calleeType:
+					case param.Type == "":
+						param.Type = calleeType
+						changed = true
+					case !reported[ref.Span]:
+						reported[ref.Span] = true
+						diagnostic := newError(CodeParamType, ref.Span, "Parameter %s is passed to %s as a %s but used as a %s", ref.Name, callee.Name, typeName(calleeType), typeName(param.Type))
+						diagnostic.Related = []Related{{callee.Params[ref.Index].Span, "parameter declared here"}}
+						analyzer.report(diagnostic)
+					}
+				}
+			}
+		}
+	}
+}
+
+func typeName(paramType string) string {
+	if paramType == "DIR" {
+		return "direction"
+	}
+	return "symbol"
+}
+
+// checkArguments reports CALL arguments that do not match the macro's
+// parameters in number or type.
+func (analyzer *SemanticAnalyzer) checkArguments(macro Macro, target Target) Diagnostics {
+	if len(target.Args) != len(macro.Params) {
+		diagnostic := newError(CodeMacroArity, target.NameSpan, "Macro %s takes %d argument(s) but got %d", macro.Name, len(macro.Params), len(target.Args))
+		diagnostic.Related = []Related{{macro.Span, "defined here"}}
+		return Diagnostics{diagnostic}
+	}
+
+	var errs Diagnostics
+	for i, arg := range target.Args {
+		param := macro.Params[i]
+		if param.Type == "" || param.Type == arg.Type {
+			continue
+		}
+
+		var diagnostic Diagnostic
+		if param.Type == "SYMBOL" {
+			diagnostic = newError(CodeArgumentType, arg.Span, "Argument %s for parameter %s must be a symbol", arg.Value, param.Name)
+			diagnostic.Fix = &Fix{
+				Message:     fmt.Sprintf("Quote it as the symbol %s", QuoteSymbol(arg.Value)),
+				Span:        arg.Span,
+				Replacement: QuoteSymbol(arg.Value),
+			}
+		} else {
+			diagnostic = newError(CodeArgumentType, arg.Span, "Argument %s for parameter %s must be a direction (L, R or S)", QuoteSymbol(arg.Value), param.Name)
+		}
+		diagnostic.Related = []Related{{param.Span, "parameter declared here"}}
+		errs = append(errs, diagnostic)
+	}
+	return errs
+}
+
+// instantiate returns the macro body with every parameter replaced by the
+// matching argument of the call.
+func instantiate(macro Macro, args []Argument) []Transition {
+	if len(macro.Params) == 0 {
+		return macro.Body
+	}
+
+	values := make(map[string]Argument)
+	for i, param := range macro.Params {
+		values[param.Name] = args[i]
+	}
+
+	body := make([]Transition, len(macro.Body))
+	for i, transition := range macro.Body {
+		set := append([]string{}, transition.ReadSet...)
+		transition.Target.Args = append([]Argument(nil), transition.Target.Args...)
+		for _, ref := range transition.Params {
+			value := values[ref.Name].Value
+			switch ref.Slot {
+			case "READ":
+				transition.Read = value
+			case "SET":
+				set[ref.Index] = value
+			case "WRITE":
+				transition.Write = value
+			case "DIR":
+				transition.Dir = value
+			case "ARG": // Keeps the span of the name passed on, for errors
+				transition.Target.Args[ref.Index].Value = value
+				transition.Target.Args[ref.Index].Type = values[ref.Name].Type
+			}
+		}
+
+		transition.ReadSet = nil // An argument may repeat a listed symbol
+		seen := make(map[string]bool)
+		for _, symbol := range set {
+			if !seen[symbol] {
+				seen[symbol] = true
+				transition.ReadSet = append(transition.ReadSet, symbol)
+			}
+		}
+		transition.Params = nil
+		body[i] = transition
+	}
+	return body
+}
+
+// instanceKey identifies one expansion of a macro for a list of arguments.
+func instanceKey(name string, args []Argument) string {
+	values := make([]string, len(args))
+	for i, arg := range args {
+		values[i] = arg.Value
+	}
+	return name + "(" + strings.Join(values, "\x00") + ")"
+}
+
+// checkAlphabet validates the declared INPUT and TAPE alphabets, and every
+// symbol read or written against TAPE when it is declared.
+func (analyzer *SemanticAnalyzer) checkAlphabet(macroNames []string) {
+	meta := analyzer.IR.Meta
+	blank := meta.BlankSymbol()
+	inputSpan := analyzer.IR.ConfigSpans["INPUT:"]
+	tapeSpan := analyzer.IR.ConfigSpans["TAPE:"]
+
+	for _, symbol := range meta.InputAlphabet {
+		if symbol == blank {
+			analyzer.report(newError(CodeInvalidAlphabet, inputSpan, "INPUT cannot contain the blank symbol %s", QuoteSymbol(blank)))
+		}
+	}
+
+	if len(meta.TapeAlphabet) == 0 {
+		return
+	}
+
+	tape := map[string]bool{blank: true} // The blank is always a tape symbol
+	for _, symbol := range meta.TapeAlphabet {
+		tape[symbol] = true
+	}
+	for _, symbol := range meta.InputAlphabet {
+		if !tape[symbol] {
+			diagnostic := newError(CodeInvalidAlphabet, inputSpan, "INPUT symbol %s is not in TAPE", QuoteSymbol(symbol))
+			diagnostic.Related = []Related{{tapeSpan, "TAPE declared here"}}
+			analyzer.report(diagnostic)
+		}
+	}
+
+	check := func(symbol string, span Span, verb string) {
+		if !tape[symbol] {
+			diagnostic := newError(CodeUnknownSymbol, span, "Symbol %s is %s but is not in TAPE", QuoteSymbol(symbol), verb)
+			diagnostic.Related = []Related{{tapeSpan, "TAPE declared here"}}
+			analyzer.report(diagnostic)
+		}
+	}
+	bodies := [][]Transition{analyzer.IR.Main}
+	for _, name := range macroNames {
+		bodies = append(bodies, analyzer.IR.Macros[name].Body)
+	}
+	for _, body := range bodies {
+		for _, transition := range body {
+			if transition.ReadType == "SYMBOL" && !transition.IsParam("READ", 0) {
+				check(transition.Read, transition.ReadSpan, "read")
+			}
+			for i, symbol := range transition.ReadSet {
+				if !transition.IsParam("SET", i) {
+					check(symbol, transition.ReadSpan, "read")
+				}
+			}
+			if !transition.WriteSame && !transition.IsParam("WRITE", 0) {
+				check(transition.Write, transition.WriteSpan, "written")
+			}
+			for _, arg := range transition.Target.Args {
+				if arg.Type == "SYMBOL" {
+					check(arg.Value, arg.Span, "passed")
+				}
+			}
+		}
+	}
+}
+
+// patternAlphabet is the alphabet read patterns expand over: the declared
+// TAPE, or when there is none every symbol the program mentions.
+// Both include the blank.
+func (analyzer *SemanticAnalyzer) patternAlphabet(macroNames []string) []string {
+	meta := analyzer.IR.Meta
+	if len(meta.TapeAlphabet) > 0 {
+		return withBlank(meta.TapeAlphabet, meta.BlankSymbol())
+	}
+
+	symbols := append([]string{}, meta.InputAlphabet...)
+	bodies := [][]Transition{analyzer.IR.Main}
+	for _, name := range macroNames {
+		bodies = append(bodies, analyzer.IR.Macros[name].Body)
+	}
+	for _, body := range bodies {
+		for _, transition := range body {
+			if transition.ReadType == "SYMBOL" && !transition.IsParam("READ", 0) {
+				symbols = append(symbols, transition.Read)
+			}
+			for i, symbol := range transition.ReadSet {
+				if !transition.IsParam("SET", i) {
+					symbols = append(symbols, symbol)
+				}
+			}
+			if !transition.WriteSame && !transition.IsParam("WRITE", 0) {
+				symbols = append(symbols, transition.Write)
+			}
+			for _, arg := range transition.Target.Args {
+				if arg.Type == "SYMBOL" {
+					symbols = append(symbols, arg.Value)
+				}
+			}
+		}
+	}
+	return withBlank(symbols, meta.BlankSymbol())
+}
+
+// checkInferredAlphabet warns at the first * or ! pattern when neither
+// TAPE nor INPUT is declared: they then cover only the symbols the program
+// mentions, and input holding any other symbol crashes on them.
+func (analyzer *SemanticAnalyzer) checkInferredAlphabet(macroNames []string) {
+	meta := analyzer.IR.Meta
+	if len(meta.TapeAlphabet) > 0 || len(meta.InputAlphabet) > 0 {
+		return
+	}
+
+	bodies := [][]Transition{analyzer.IR.Main}
+	for _, name := range macroNames {
+		bodies = append(bodies, analyzer.IR.Macros[name].Body)
+	}
+	for _, body := range bodies {
+		for _, transition := range body {
+			if transition.ReadType != "ANY" && transition.ReadType != "NOT" {
+				continue
+			}
+			analyzer.report(newWarning(CodeInferredAlphabet, transition.ReadSpan, "%s only covers the symbols this program mentions, {%s}; declare TAPE or INPUT for input with others", transition.ReadText(), strings.Join(analyzer.Alphabet, ", ")))
+			return
+		}
+	}
+}
+
+// expandReads turns the read pattern of every line in body into concrete
+// (read, write) pairs. Explicit symbol rules take precedence over sets and
+// negations in the same state, with a warning; * covers whatever symbols of
+// the alphabet the state has no other rule for.
+func (analyzer *SemanticAnalyzer) expandReads(body []Transition) [][]symbolPair {
+	reads := make([][]string, len(body))
+	explicit := make(map[string]map[string]int) // State -> symbol -> line of its explicit rule
+	covered := make(map[string]map[string]bool) // State -> symbols read by a non-* rule
+
+	cover := func(state, symbol string) {
+		if covered[state] == nil {
+			covered[state] = make(map[string]bool)
+		}
+		covered[state][symbol] = true
+	}
+
+	for i, transition := range body {
+		if transition.ReadType != "SYMBOL" {
+			continue
+		}
+		if explicit[transition.Src] == nil {
+			explicit[transition.Src] = make(map[string]int)
+		}
+		if _, exists := explicit[transition.Src][transition.Read]; !exists {
+			explicit[transition.Src][transition.Read] = i
+		}
+		reads[i] = []string{transition.Read}
+		cover(transition.Src, transition.Read)
+	}
+
+	for i, transition := range body {
+		if transition.ReadType != "SET" && transition.ReadType != "NOT" {
+			continue
+		}
+
+		listed := make(map[string]bool)
+		for _, symbol := range transition.ReadSet {
+			listed[symbol] = true
+		}
+		candidates := transition.ReadSet
+		if transition.ReadType == "NOT" {
+			candidates = nil
+			for _, symbol := range analyzer.Alphabet {
+				if !listed[symbol] {
+					candidates = append(candidates, symbol)
+				}
+			}
+		}
+
+		for _, symbol := range candidates {
+			if line, exists := explicit[transition.Src][symbol]; exists {
+				diagnostic := newWarning(CodeOverlappingRead, transition.ReadSpan, "%s in state %s also matches %s, which has its own rule", transition.ReadText(), transition.Src, QuoteSymbol(symbol))
+				diagnostic.Related = []Related{{body[line].Span, "this rule takes precedence"}}
+				analyzer.report(diagnostic)
+				continue
+			}
+			reads[i] = append(reads[i], symbol)
+			cover(transition.Src, symbol)
+		}
+	}
+
+	wildcards := make(map[string]int) // State -> line of its * rule
+	extraWildcards := make(map[int]bool)
+	for i, transition := range body {
+		if transition.ReadType != "ANY" {
+			continue
+		}
+		if line, exists := wildcards[transition.Src]; exists {
+			diagnostic := newError(CodeNondeterministic, transition.ReadSpan, "State %s has more than one * rule", transition.Src)
+			diagnostic.Related = []Related{{body[line].Span, "first * rule here"}}
+			analyzer.report(diagnostic)
+			extraWildcards[i] = true
+			continue
+		}
+		wildcards[transition.Src] = i
+
+		for _, symbol := range analyzer.Alphabet {
+			if !covered[transition.Src][symbol] {
+				reads[i] = append(reads[i], symbol)
+			}
+		}
+	}
+
+	pairs := make([][]symbolPair, len(body))
+	for i, transition := range body {
+		if len(reads[i]) == 0 && transition.ReadType != "SYMBOL" && !extraWildcards[i] {
+			analyzer.report(newWarning(CodeEmptyRead, transition.ReadSpan, "%s matches no symbol in state %s, so this rule is never used", transition.ReadText(), transition.Src))
+		}
+		for _, read := range reads[i] {
+			write := transition.Write
+			if transition.WriteSame {
+				write = read
+			}
+			pairs[i] = append(pairs[i], symbolPair{read, write})
+		}
+	}
+	return pairs
+}
+
+// checkDeterminism reports every (state, symbol) pair with more than one
+// rule after expansion. Identical rules are a warning; rules that disagree
+// are an error, since backends would silently pick the first one.
+func (analyzer *SemanticAnalyzer) checkDeterminism() {
+	type ruleKey struct{ Src, Read string }
+	type spanPair struct{ First, Second Span }
+
+	first := make(map[ruleKey]int)
+	reported := make(map[spanPair]bool) // A macro called twice repeats the same pair
+
+	for i, rule := range analyzer.FinalIR {
+		key := ruleKey{rule.Src, rule.Read}
+		firstIndex, exists := first[key]
+		if !exists {
+			first[key] = i
+			continue
+		}
+
+		original := analyzer.FinalIR[firstIndex]
+		pair := spanPair{original.Span, rule.Span}
+		if reported[pair] {
+			continue
+		}
+		reported[pair] = true
+
+		var diagnostic Diagnostic
+		note := "conflicts with this rule"
+		if original.Write == rule.Write && original.Dir == rule.Dir && original.Next == rule.Next {
+			diagnostic = newWarning(CodeDuplicateTransition, rule.Span, "Duplicate rule for state %s reading %s", rule.Src, QuoteSymbol(rule.Read))
+			note = "first defined here"
+		} else {
+			diagnostic = newError(CodeNondeterministic, rule.Span, "State %s has conflicting rules for symbol %s", rule.Src, QuoteSymbol(rule.Read))
+		}
+
+		diagnostic.Related = append(diagnostic.Related, callChain(rule.Calls)...)
+		diagnostic.Related = append(diagnostic.Related, Related{original.Span, note})
+		diagnostic.Related = append(diagnostic.Related, callChain(original.Calls)...)
+		analyzer.report(diagnostic)
+	}
+}
+
+// callChain describes the CALLs a rule was expanded through, innermost first.
+func callChain(calls []CallSite) []Related {
+	var related []Related
+	for i := len(calls) - 1; i >= 0; i-- {
+		related = append(related, Related{calls[i].Span, fmt.Sprintf("expanded from CALL %s", calls[i].Macro)})
+	}
+	return related
+}
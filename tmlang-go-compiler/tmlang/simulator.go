@@ -0,0 +1,324 @@
+package tmlang
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Halt statuses reported by the Simulator.
+const (
+	StatusRunning   = "RUNNING"
+	StatusAccepted  = "ACCEPTED"
+	StatusRejected  = "REJECTED"
+	StatusCrash     = "CRASH"       // No rule for the current (state, symbol)
+	StatusTimeout   = "TIMEOUT"     // Step limit reached before halting
+	StatusOutOfTape = "OUT_OF_TAPE" // A move would use more cells than MaxCells
+)
+
+// tapeChunk is the least number of cells the tape grows by at either end.
+const tapeChunk = 1024
+
+// ValidateInput checks input against the declared INPUT alphabet, or
+// without one the TAPE alphabet, if either is declared.
+func (meta Meta) ValidateInput(input string) error {
+	symbols := meta.InputSymbols()
+	if symbols == nil {
+		return nil
+	}
+	alphabet := "INPUT"
+	if len(meta.InputAlphabet) == 0 {
+		alphabet = "TAPE"
+	}
+
+	allowed := make(map[string]bool)
+	for _, symbol := range symbols {
+		allowed[symbol] = true
+	}
+	for i, char := range []rune(input) {
+		if !allowed[string(char)] {
+			return fmt.Errorf("input symbol %q at position %d is not in the %s alphabet {%s}", char, i, alphabet, strings.Join(symbols, ", "))
+		}
+	}
+	return nil
+}
+
+// Simulator interprets a flat transition table one step at a time. The tape
+// is unbounded: it grows in either direction as the head reaches its ends.
+type Simulator struct {
+	Meta   Meta
+	Rules  map[string]map[string]*FlatTransition // State -> Read symbol -> Rule
+	Source SourceMap
+	Tape   []rune // Cells allocated so far
+	Offset int    // Index in Tape of position 0, the first input cell
+	Blank  rune
+	Head   int // Position of the head, negative left of the input
+	State  string
+	Steps  int
+	Status string
+
+	MaxCells int  // Halt with OUT_OF_TAPE rather than use more cells than this; 0 for no limit
+	Record   bool // Keep undo information for every step, for Back, Seek, Bisect and FirstWrite
+	low      int  // Leftmost position used so far
+	high     int  // Rightmost position used so far
+
+	history []stepRecord // One per step taken while Record was set, oldest first
+}
+
+// stepRecord is what Back needs to undo one step instead of a copy of the
+// tape: the rule it applied, which gives the state before it and how the
+// head moved, the symbol it overwrote, and whether it widened the range of
+// cells used.
+type stepRecord struct {
+	Rule        *FlatTransition
+	Overwritten rune
+	Widened     int8 // -1 if the step lowered low, 1 if it raised high, else 0
+}
+
+func (sim *Simulator) InitSimulator(transitions []FlatTransition, meta Meta, input string) {
+	sim.Meta = meta
+	sim.Rules = make(map[string]map[string]*FlatTransition)
+	sim.Source = NewSourceMap(transitions)
+
+	for i := range transitions {
+		t := &transitions[i]
+		if sim.Rules[t.Src] == nil {
+			sim.Rules[t.Src] = make(map[string]*FlatTransition)
+		}
+		if _, exists := sim.Rules[t.Src][t.Read]; !exists { // First rule wins, like the C backend
+			sim.Rules[t.Src][t.Read] = t
+		}
+	}
+
+	sim.Blank = []rune(meta.BlankSymbol())[0]
+	cells := []rune(input)
+	sim.Tape = sim.blanks(tapeChunk + len(cells) + tapeChunk)
+	sim.Offset = tapeChunk
+	copy(sim.Tape[sim.Offset:], cells)
+
+	sim.Head = 0
+	sim.low, sim.high = 0, max(len(cells)-1, 0)
+	sim.State = meta.Start
+	sim.Steps = 0
+	sim.Status = StatusRunning
+	sim.history = nil
+	sim.checkHalt()
+}
+
+func (sim *Simulator) checkHalt() {
+	switch sim.State {
+	case sim.Meta.Accept:
+		sim.Status = StatusAccepted
+	case sim.Meta.Reject:
+		sim.Status = StatusRejected
+	}
+}
+
+func (sim *Simulator) blanks(n int) []rune {
+	cells := make([]rune, n)
+	for i := range cells {
+		cells[i] = sim.Blank
+	}
+	return cells
+}
+
+// Cell returns the symbol at position, blank for cells never written.
+func (sim *Simulator) Cell(position int) rune {
+	index := sim.Offset + position
+	if index < 0 || index >= len(sim.Tape) {
+		return sim.Blank
+	}
+	return sim.Tape[index]
+}
+
+// setCell writes position, first growing the tape to reach it. Growth at
+// least doubles the tape, so a long walk costs amortized constant time.
+func (sim *Simulator) setCell(position int, symbol rune) {
+	index := sim.Offset + position
+	if index < 0 {
+		grow := max(-index, len(sim.Tape), tapeChunk)
+		sim.Tape = append(sim.blanks(grow), sim.Tape...)
+		sim.Offset += grow
+		index += grow
+	} else if index >= len(sim.Tape) {
+		grow := max(index-len(sim.Tape)+1, len(sim.Tape), tapeChunk)
+		sim.Tape = append(sim.Tape, sim.blanks(grow)...)
+	}
+	sim.Tape[index] = symbol
+}
+
+// CurrentRule returns the rule that the next Step will apply, or nil.
+func (sim *Simulator) CurrentRule() *FlatTransition {
+	return sim.Rules[sim.State][string(sim.Cell(sim.Head))]
+}
+
+// Origin returns where the current state was written in the source and the
+// CALLs that led there, if it has rules of its own.
+func (sim *Simulator) Origin() (StateOrigin, bool) {
+	origin, exists := sim.Source[sim.State]
+	return origin, exists
+}
+
+// Step applies a single transition and reports whether the machine is still running.
+func (sim *Simulator) Step() bool {
+	if sim.Status != StatusRunning {
+		return false
+	}
+
+	match := sim.CurrentRule()
+	if match == nil {
+		sim.Status = StatusCrash
+		return false
+	}
+
+	next := sim.Head + moveOf(match.Dir)
+	low, high := min(sim.low, next), max(sim.high, next)
+	if sim.MaxCells > 0 && high-low+1 > sim.MaxCells { // The step is not taken
+		sim.Status = StatusOutOfTape
+		return false
+	}
+
+	if sim.Record {
+		record := stepRecord{Rule: match, Overwritten: sim.Cell(sim.Head)}
+		switch {
+		case low < sim.low:
+			record.Widened = -1
+		case high > sim.high:
+			record.Widened = 1
+		}
+		sim.history = append(sim.history, record)
+	}
+	if len(match.Write) > 0 {
+		sim.setCell(sim.Head, []rune(match.Write)[0])
+	}
+	sim.Head, sim.low, sim.high = next, low, high
+	sim.State = match.Next
+	sim.Steps++
+	sim.checkHalt()
+
+	return sim.Status == StatusRunning
+}
+
+// Run steps until the machine halts or maxSteps transitions have been taken.
+func (sim *Simulator) Run(maxSteps int) string {
+	for sim.Status == StatusRunning {
+		if sim.Steps >= maxSteps {
+			sim.Status = StatusTimeout
+			break
+		}
+		sim.Step()
+	}
+	return sim.Status
+}
+
+// Back undoes the last recorded step and reports whether there was one.
+// The machine is running again afterwards, whatever stopped it.
+func (sim *Simulator) Back() bool {
+	n := len(sim.history)
+	if n == 0 {
+		return false
+	}
+	record := sim.history[n-1]
+	sim.history = sim.history[:n-1]
+
+	sim.Head -= moveOf(record.Rule.Dir)
+	if len(record.Rule.Write) > 0 {
+		sim.setCell(sim.Head, record.Overwritten)
+	}
+	switch record.Widened {
+	case -1:
+		sim.low++
+	case 1:
+		sim.high--
+	}
+	sim.State = record.Rule.Src
+	sim.Steps--
+	sim.Status = StatusRunning
+	return true
+}
+
+// Seek moves the machine to step, backwards through the recorded history or
+// forwards by running it, and returns the step reached: earlier than asked
+// if the machine halts first, later if the steps before were not recorded.
+func (sim *Simulator) Seek(step int) int {
+	for sim.Steps > step {
+		if !sim.Back() {
+			break
+		}
+	}
+	for sim.Steps < step {
+		if !sim.Step() {
+			break
+		}
+	}
+	return sim.Steps
+}
+
+// Bisect finds the first recorded step up to the current one where pred
+// holds, assuming that once it holds it keeps holding, like "the head has
+// been past position 100". It leaves the machine at that step and returns
+// it, or returns false and leaves the machine alone if pred does not hold
+// now.
+func (sim *Simulator) Bisect(pred func(*Simulator) bool) (int, bool) {
+	if !pred(sim) {
+		return sim.Steps, false
+	}
+	low, high := sim.Steps-len(sim.history), sim.Steps // pred holds at high
+	for low < high {
+		mid := (low + high) / 2
+		sim.Seek(mid)
+		if pred(sim) {
+			high = mid
+		} else {
+			low = mid + 1
+		}
+	}
+	return sim.Seek(low), true
+}
+
+// FirstWrite returns the first recorded step after which the cell at
+// position holds symbol, having held another symbol before it. It reads
+// the history without moving the machine.
+func (sim *Simulator) FirstWrite(position int, symbol rune) (int, bool) {
+	heads := make([]int, len(sim.history)) // Head position before each recorded step
+	head := sim.Head
+	for i := len(sim.history) - 1; i >= 0; i-- {
+		head -= moveOf(sim.history[i].Rule.Dir)
+		heads[i] = head
+	}
+
+	first := sim.Steps - len(sim.history)
+	for i, record := range sim.history {
+		if heads[i] == position && record.Overwritten != symbol && record.Rule.Write == string(symbol) {
+			return first + i + 1, true
+		}
+	}
+	return 0, false
+}
+
+// TapeWindow returns the cells in [head-radius, head+radius) and the
+// head's index within that string.
+func (sim *Simulator) TapeWindow(radius int) (string, int) {
+	window := make([]rune, 0, 2*radius)
+	for position := sim.Head - radius; position < sim.Head+radius; position++ {
+		window = append(window, sim.Cell(position))
+	}
+	return string(window), radius
+}
+
+// TapeContents returns the tape with leading and trailing blanks removed,
+// and the head's offset from the first returned cell.
+func (sim *Simulator) TapeContents() (string, int) {
+	first, last := -1, -1
+	for i, cell := range sim.Tape {
+		if cell != sim.Blank {
+			if first == -1 {
+				first = i
+			}
+			last = i
+		}
+	}
+	if first == -1 {
+		return "", 0
+	}
+	return string(sim.Tape[first : last+1]), sim.Offset + sim.Head - first
+}
@@ -0,0 +1,55 @@
+package tmlang
+
+import "fmt"
+
+// StateOrigin is where a flat state was written: its name before macro
+// expansion renamed it, the line of its first rule, and the CALLs whose
+// expansion created it, outermost first.
+type StateOrigin struct {
+	Name  string
+	Span  Span
+	Calls []CallSite
+}
+
+// Macro returns the macro the state was written in, "" for MAIN.
+func (origin StateOrigin) Macro() string {
+	if len(origin.Calls) == 0 {
+		return ""
+	}
+	return origin.Calls[len(origin.Calls)-1].Macro
+}
+
+// Describe formats the origin on one line, innermost CALL first:
+// "q0 at lib.tm:3:9 in move_end, called at main.tm:12:20".
+func (origin StateOrigin) Describe(mainFile string) string {
+	text := fmt.Sprintf("%s at %s", origin.Name, origin.Span.Location(mainFile))
+	for i := len(origin.Calls) - 1; i >= 0; i-- {
+		text += fmt.Sprintf(", in %s called at %s", origin.Calls[i].Macro, origin.Calls[i].Span.Location(mainFile))
+	}
+	return text
+}
+
+// SourceMap maps each state of a flat transition table back to its origin.
+// States without rules of their own, like ACCEPT and REJECT, are absent.
+type SourceMap map[string]StateOrigin
+
+// NewSourceMap builds the map from the first rule of each state.
+func NewSourceMap(transitions []FlatTransition) SourceMap {
+	sourceMap := make(SourceMap)
+	for _, t := range transitions {
+		if _, exists := sourceMap[t.Src]; !exists {
+			sourceMap[t.Src] = StateOrigin{Name: t.SrcName, Span: t.Span, Calls: t.Calls}
+		}
+	}
+	return sourceMap
+}
+
+// Describe returns the origin of state on one line, or state itself when it
+// has no origin.
+func (sourceMap SourceMap) Describe(state string, mainFile string) string {
+	origin, exists := sourceMap[state]
+	if !exists {
+		return state
+	}
+	return origin.Describe(mainFile)
+}
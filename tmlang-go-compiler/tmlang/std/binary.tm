@@ -0,0 +1,23 @@
+// Binary numbers, most significant bit first. Each macro starts and ends on
+// the first bit.
+// IMPORT "std:binary"
+MACROS:
+    // n -> n + 1, growing by one bit on overflow: 11 -> 100
+    DEF increment:
+        m0,    {0, 1} -> =, R, m0
+        m0,    _      -> _, L, carry
+        carry, 1      -> 0, L, carry
+        carry, 0      -> 1, L, back
+        carry, _      -> 1, S, RETURN
+        back,  {0, 1} -> =, L, back
+        back,  _      -> _, R, RETURN
+
+    // n -> n - 1, wrapping 0 around to all 1s: 00 -> 11
+    DEF decrement:
+        m0,     {0, 1} -> =, R, m0
+        m0,     _      -> _, L, borrow
+        borrow, 0      -> 1, L, borrow
+        borrow, 1      -> 0, L, back
+        borrow, _      -> _, R, RETURN
+        back,   {0, 1} -> =, L, back
+        back,   _      -> _, R, RETURN
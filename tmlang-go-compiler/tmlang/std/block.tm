@@ -0,0 +1,101 @@
+// Blocks: runs of 0s and 1s between blanks. Each macro starts on the first
+// symbol of a block. copy and compare mark cells with X and Y while they
+// work and restore them before returning.
+// IMPORT "std:block"
+MACROS:
+    // 0110 -> 0110_0110, ending on the first symbol of the original
+    DEF copy:
+        m0,     0      -> X, R, carry0
+        m0,     1      -> Y, R, carry1
+        m0,     _      -> _, L, back
+        carry0, {0, 1} -> =, R, carry0
+        carry0, _      -> _, R, put0
+        carry1, {0, 1} -> =, R, carry1
+        carry1, _      -> _, R, put1
+        put0,   {0, 1} -> =, R, put0
+        put0,   _      -> 0, L, copied
+        put1,   {0, 1} -> =, R, put1
+        put1,   _      -> 1, L, copied
+        copied, {0, 1} -> =, L, copied
+        copied, _      -> _, L, marked
+        marked, {0, 1} -> =, L, marked
+        marked, X      -> 0, R, m0
+        marked, Y      -> 1, R, m0
+        back,   {0, 1} -> =, L, back
+        back,   _      -> _, R, RETURN
+
+    // Compare the block with the one after the next blank:
+    // 0110_0110 returns through equal, 0110_0111 through differ.
+    // Ends on the first symbol of the first block.
+    DEF compare:
+        m0,        0      -> X, R, carry0
+        m0,        1      -> Y, R, carry1
+        m0,        _      -> _, R, tail
+        carry0,    {0, 1} -> =, R, carry0
+        carry0,    _      -> _, R, match0
+        carry1,    {0, 1} -> =, R, carry1
+        carry1,    _      -> _, R, match1
+        match0,    {X, Y} -> =, R, match0
+        match0,    0      -> X, L, matched
+        match0,    *      -> =, S, ne_end
+        match1,    {X, Y} -> =, R, match1
+        match1,    1      -> Y, L, matched
+        match1,    *      -> =, S, ne_end
+        matched,   !_     -> =, L, matched
+        matched,   _      -> _, L, marked
+        marked,    {0, 1} -> =, L, marked
+        marked,    {X, Y} -> =, R, m0
+        tail,      {X, Y} -> =, R, tail
+        tail,      _      -> _, L, eq_second
+        tail,      {0, 1} -> =, S, ne_end
+        eq_second, X      -> 0, L, eq_second
+        eq_second, Y      -> 1, L, eq_second
+        eq_second, _      -> _, L, eq_first
+        eq_first,  X      -> 0, L, eq_first
+        eq_first,  Y      -> 1, L, eq_first
+        eq_first,  _      -> _, R, RETURN equal
+        ne_end,    !_     -> =, R, ne_end
+        ne_end,    _      -> _, L, ne_second
+        ne_second, X      -> 0, L, ne_second
+        ne_second, Y      -> 1, L, ne_second
+        ne_second, {0, 1} -> =, L, ne_second
+        ne_second, _      -> _, L, ne_first
+        ne_first,  X      -> 0, L, ne_first
+        ne_first,  Y      -> 1, L, ne_first
+        ne_first,  {0, 1} -> =, L, ne_first
+        ne_first,  _      -> _, R, RETURN differ
+
+    // 0110 -> _0110, ending on the blank where the block started
+    DEF shift_right:
+        m0,     0      -> _, R, carry0
+        m0,     1      -> _, R, carry1
+        m0,     _      -> _, S, RETURN
+        carry0, 0      -> 0, R, carry0
+        carry0, 1      -> 0, R, carry1
+        carry0, _      -> 0, L, back
+        carry1, 0      -> 1, R, carry0
+        carry1, 1      -> 1, R, carry1
+        carry1, _      -> 1, L, back
+        back,   {0, 1} -> =, L, back
+        back,   _      -> _, S, RETURN
+
+    // 0110 -> 110, dropping the first symbol and ending on the new first
+    DEF shift_left:
+        m0,     {0, 1} -> =, R, m0
+        m0,     _      -> _, L, last
+        last,   0      -> _, L, carry0
+        last,   1      -> _, L, carry1
+        last,   _      -> _, R, RETURN
+        carry0, 0      -> 0, L, carry0
+        carry0, 1      -> 0, L, carry1
+        carry0, _      -> _, R, RETURN
+        carry1, 0      -> 1, L, carry0
+        carry1, 1      -> 1, L, carry1
+        carry1, _      -> _, R, RETURN
+
+    // Blank out the whole block, of any symbols, ending on its first cell
+    DEF erase:
+        m0,   !_ -> =, R, m0
+        m0,   _  -> _, L, last
+        last, !_ -> _, L, last
+        last, _  -> _, R, RETURN
@@ -0,0 +1,42 @@
+// Head movement over any tape alphabet, treating _ as the blank.
+// IMPORT "std:seek"
+MACROS:
+    // Move right to the first blank
+    DEF right_blank:
+        m0, !_ -> =, R, m0
+        m0, _  -> _, S, RETURN
+
+    // Move left to the first blank
+    DEF left_blank:
+        m0, !_ -> =, L, m0
+        m0, _  -> _, S, RETURN
+
+    // Move right to the last symbol before a blank
+    DEF right_end:
+        m0, !_ -> =, R, m0
+        m0, _  -> _, L, RETURN
+
+    // Move left to the first symbol after a blank
+    DEF left_end:
+        m0, !_ -> =, L, m0
+        m0, _  -> _, R, RETURN
+
+    // Move right to the first sym; runs forever when there is none
+    DEF right_to(sym):
+        m0, sym -> =, S, RETURN
+        m0, *   -> =, R, m0
+
+    // Move left to the first sym; runs forever when there is none
+    DEF left_to(sym):
+        m0, sym -> =, S, RETURN
+        m0, *   -> =, L, m0
+
+    // Move in dir past every sym, stopping on the first other symbol
+    DEF skip(sym, dir):
+        m0, sym -> =, dir, m0
+        m0, *   -> =, S,   RETURN
+
+    // Move in dir past every first or second, stopping on any other symbol
+    DEF skip_either(first, second, dir):
+        m0, {first, second} -> =, dir, m0
+        m0, *               -> =, S,   RETURN
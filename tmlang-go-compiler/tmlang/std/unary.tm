@@ -0,0 +1,19 @@
+// Unary numbers: n is a block of n 1s, and 0 the empty block. Each macro
+// starts and ends on the first 1, or on the blank where an empty block is.
+// IMPORT "std:unary"
+MACROS:
+    // n -> n + 1
+    DEF increment:
+        m0,   1 -> 1, R, m0
+        m0,   _ -> 1, L, back
+        back, 1 -> 1, L, back
+        back, _ -> _, R, RETURN
+
+    // n -> n - 1, leaving 0 as it is
+    DEF decrement:
+        m0,   1 -> 1, R, m0
+        m0,   _ -> _, L, last
+        last, 1 -> _, L, back
+        last, _ -> _, R, RETURN
+        back, 1 -> 1, L, back
+        back, _ -> _, R, RETURN
@@ -0,0 +1,47 @@
+package tmlang
+
+import (
+	"embed"
+	"fmt"
+	"io/fs"
+	"strings"
+)
+
+// stdPrefix marks an IMPORT of a library bundled with the compiler,
+// IMPORT "std:seek", rather than a path.
+const stdPrefix = "std:"
+
+//go:embed std/*.tm
+var stdlib embed.FS
+
+// StdLibraries lists the names of the bundled libraries, seek for std:seek.
+func StdLibraries() []string {
+	entries, _ := fs.ReadDir(stdlib, "std")
+	names := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		names = append(names, strings.TrimSuffix(entry.Name(), ".tm"))
+	}
+	return names
+}
+
+// readStd returns the source of a bundled library, named std:<name>.
+func readStd(file string) ([]byte, error) {
+	name := strings.TrimPrefix(file, stdPrefix)
+	source, err := stdlib.ReadFile("std/" + name + ".tm")
+	if err != nil {
+		return nil, fmt.Errorf("no standard library named %s, expected one of %s", name, strings.Join(StdLibraries(), ", "))
+	}
+	return source, nil
+}
+
+// StdSource returns the source of a bundled library file, std:seek, for
+// tools that show it, like a debugger stopped in one of its macros.
+func StdSource(file string) (string, error) {
+	source, err := readStd(file)
+	return string(source), err
+}
+
+// IsStdFile reports whether file names a bundled library rather than a path.
+func IsStdFile(file string) bool {
+	return strings.HasPrefix(file, stdPrefix)
+}
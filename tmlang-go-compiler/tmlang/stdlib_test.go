@@ -0,0 +1,157 @@
+package tmlang
+
+import (
+	"fmt"
+	"testing"
+)
+
+// stdCase runs one CALL of a bundled macro on input, starting at position
+// start, and expects the tape, head position and halting state afterwards.
+// Positions count from the first input cell, and Tape runs from there, or
+// from an earlier symbol, to the last symbol.
+type stdCase struct {
+	Call  string // CALL target and return binding, e.g. "seek.right_blank -> qa"
+	Input string
+	Start int
+	Tape  string
+	Head  int
+	State string // qa unless the CALL binds other exits
+}
+
+var stdCases = map[string][]stdCase{
+	"seek": {
+		{Call: "seek.right_blank -> qa", Input: "abc", Tape: "abc", Head: 3},
+		{Call: "seek.right_blank -> qa", Input: "", Tape: "", Head: 0},
+		{Call: "seek.left_blank -> qa", Input: "abc", Start: 2, Tape: "abc", Head: -1},
+		{Call: "seek.right_end -> qa", Input: "abc", Tape: "abc", Head: 2},
+		{Call: "seek.left_end -> qa", Input: "abc", Start: 2, Tape: "abc", Head: 0},
+		{Call: "seek.right_to('#') -> qa", Input: "ab#c", Tape: "ab#c", Head: 2},
+		{Call: "seek.left_to(a) -> qa", Input: "abba", Start: 2, Tape: "abba", Head: 0},
+		{Call: "seek.skip(a, R) -> qa", Input: "aaab", Tape: "aaab", Head: 3},
+		{Call: "seek.skip(a, R) -> qa", Input: "baaa", Tape: "baaa", Head: 0},
+		{Call: "seek.skip(b, L) -> qa", Input: "abbb", Start: 3, Tape: "abbb", Head: 0},
+		{Call: "seek.skip_either(a, b, R) -> qa", Input: "abbac", Tape: "abbac", Head: 4},
+		{Call: "seek.skip_either(a, b, R) -> qa", Input: "ab", Tape: "ab", Head: 2},
+	},
+	"unary": {
+		{Call: "unary.increment -> qa", Input: "111", Tape: "1111", Head: 0},
+		{Call: "unary.increment -> qa", Input: "", Tape: "1", Head: 0},
+		{Call: "unary.decrement -> qa", Input: "111", Tape: "11", Head: 0},
+		{Call: "unary.decrement -> qa", Input: "1", Tape: "", Head: 0},
+		{Call: "unary.decrement -> qa", Input: "", Tape: "", Head: 0},
+	},
+	"binary": {
+		{Call: "binary.increment -> qa", Input: "1011", Tape: "1100", Head: 0},
+		{Call: "binary.increment -> qa", Input: "0", Tape: "1", Head: 0},
+		{Call: "binary.increment -> qa", Input: "111", Tape: "1000", Head: -1},
+		{Call: "binary.decrement -> qa", Input: "1100", Tape: "1011", Head: 0},
+		{Call: "binary.decrement -> qa", Input: "1", Tape: "0", Head: 0},
+		{Call: "binary.decrement -> qa", Input: "00", Tape: "11", Head: 0},
+	},
+	"block": {
+		{Call: "block.copy -> qa", Input: "0110", Tape: "0110_0110", Head: 0},
+		{Call: "block.copy -> qa", Input: "1", Tape: "1_1", Head: 0},
+		{Call: "block.compare -> equal: qa, differ: qr", Input: "0110_0110", Tape: "0110_0110", Head: 0},
+		{Call: "block.compare -> equal: qa, differ: qr", Input: "0110_0111", Tape: "0110_0111", Head: 0, State: "qr"},
+		{Call: "block.compare -> equal: qa, differ: qr", Input: "011_0110", Tape: "011_0110", Head: 0, State: "qr"},
+		{Call: "block.compare -> equal: qa, differ: qr", Input: "0110_011", Tape: "0110_011", Head: 0, State: "qr"},
+		{Call: "block.compare -> equal: qa, differ: qr", Input: "_0", Tape: "_0", Head: 0, State: "qr"},
+		{Call: "block.shift_right -> qa", Input: "0110", Tape: "_0110", Head: 0},
+		{Call: "block.shift_right -> qa", Input: "10", Tape: "_10", Head: 0},
+		{Call: "block.shift_left -> qa", Input: "0110", Tape: "110", Head: 0},
+		{Call: "block.shift_left -> qa", Input: "1", Tape: "", Head: 0},
+		{Call: "block.erase -> qa", Input: "ab01", Start: 2, Tape: "", Head: 0},
+	},
+}
+
+func TestStdLibraries(t *testing.T) {
+	for _, name := range StdLibraries() {
+		cases, exists := stdCases[name]
+		if !exists {
+			t.Errorf("std:%s has no test cases", name)
+			continue
+		}
+		for _, tc := range cases {
+			t.Run(fmt.Sprintf("%s/%s/%s", name, tc.Call, tc.Input), func(t *testing.T) {
+				runStdCase(t, name, tc)
+			})
+		}
+	}
+}
+
+func runStdCase(t *testing.T, library string, tc stdCase) {
+	// q0 walks to the start cell, then the macro runs from there
+	source := fmt.Sprintf("IMPORT %q\nCONFIG:\n    START: q0\n    ACCEPT: qa\n    REJECT: qr\n    TAPE: 0, 1, a, b, c, X, Y, '#'\nMAIN:\n", stdPrefix+library)
+	for i := 0; i < tc.Start; i++ {
+		source += fmt.Sprintf("    q%d, * -> =, R, q%d\n", i, i+1)
+	}
+	source += fmt.Sprintf("    q%d, * -> =, S, CALL %s\n", tc.Start, tc.Call)
+
+	result, err := Compile(source, Options{})
+	if err != nil {
+		t.Fatalf("compile failed:\n%v", err)
+	}
+	for _, d := range result.Diagnostics {
+		t.Errorf("unexpected diagnostic: %v", d)
+	}
+
+	var sim Simulator
+	sim.InitSimulator(result.Transitions, result.IR.Meta, tc.Input)
+	sim.Run(10000)
+
+	want := tc.State
+	if want == "" {
+		want = "qa"
+	}
+	if sim.State != want {
+		t.Errorf("halted in %s (%s), want %s", sim.State, sim.Status, want)
+	}
+	first, last := 0, -1
+	for i, cell := range sim.Tape {
+		if cell != sim.Blank {
+			first, last = min(first, i-sim.Offset), max(last, i-sim.Offset)
+		}
+	}
+	tape := ""
+	for position := first; position <= last; position++ {
+		tape += string(sim.Cell(position))
+	}
+	if tape != tc.Tape {
+		t.Errorf("tape = %q, want %q", tape, tc.Tape)
+	}
+	if sim.Head != tc.Head {
+		t.Errorf("head = %d, want %d", sim.Head, tc.Head)
+	}
+}
+
+// A program with its own BLANK gets std: macros that treat it as the blank,
+// unless a library already uses it as a symbol.
+func TestStdCustomBlank(t *testing.T) {
+	source := "IMPORT \"std:unary\"\nCONFIG:\n    START: q0\n    ACCEPT: qa\n    REJECT: qr\n    BLANK: B\n    TAPE: 1\nMAIN:\n    q0, * -> =, S, CALL unary.increment -> qa\n"
+	result, err := Compile(source, Options{})
+	if err != nil {
+		t.Fatalf("compile failed:\n%v", err)
+	}
+	var sim Simulator
+	sim.InitSimulator(result.Transitions, result.IR.Meta, "11")
+	sim.Run(10000)
+	if sim.State != "qa" {
+		t.Fatalf("halted in %s (%s), want qa", sim.State, sim.Status)
+	}
+	tape := ""
+	for position := -1; position <= 3; position++ {
+		tape += string(sim.Cell(position))
+	}
+	if tape != "B111B" {
+		t.Errorf("tape = %q, want %q", tape, "B111B")
+	}
+
+	clash := "IMPORT \"std:block\"\nCONFIG:\n    START: q0\n    ACCEPT: qa\n    REJECT: qr\n    BLANK: X\nMAIN:\n    q0, * -> =, S, CALL block.copy -> qa\n"
+	result, err = Compile(clash, Options{})
+	if err == nil {
+		t.Fatal("compile succeeded, want an import error for BLANK: X, which std:block uses")
+	}
+	if errs := result.Diagnostics.Errors(); len(errs) == 0 || errs[0].Code != CodeImportError {
+		t.Errorf("diagnostics = %v, want %s", errs, CodeImportError)
+	}
+}
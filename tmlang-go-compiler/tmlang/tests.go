@@ -0,0 +1,71 @@
+package tmlang
+
+import "fmt"
+
+// DefaultTestSteps is the step limit of test cases before any MAXSTEPS line.
+const DefaultTestSteps = 100000
+
+// TestResult is the outcome of running one TestCase.
+type TestResult struct {
+	Test    TestCase
+	Passed  bool
+	Status  string // How the run ended, "" if the input was never run
+	Tape    string // Final tape without leading and trailing blanks
+	Steps   int
+	Failure string // Why the case failed, "" if it passed
+}
+
+// RunTests runs every case of the program's TESTS section on its compiled
+// machine, in order.
+func RunTests(result *Result) []TestResult {
+	results := make([]TestResult, len(result.IR.Tests))
+	for i, test := range result.IR.Tests {
+		results[i] = RunTest(result.Transitions, result.IR.Meta, test)
+	}
+	return results
+}
+
+// RunTest runs one case with the interpreter. A case expecting only a tape
+// also expects the machine to halt, by ACCEPT or REJECT.
+func RunTest(transitions []FlatTransition, meta Meta, test TestCase) TestResult {
+	result := TestResult{Test: test}
+	if err := meta.ValidateInput(test.Input); err != nil {
+		result.Failure = err.Error()
+		return result
+	}
+
+	var sim Simulator
+	sim.InitSimulator(transitions, meta, test.Input)
+	result.Status = sim.Run(test.MaxSteps)
+	result.Tape, _ = sim.TapeContents()
+	result.Steps = sim.Steps
+
+	halted := result.Status == StatusAccepted || result.Status == StatusRejected
+	switch {
+	case test.Expect != "" && result.Status != expectedStatus[test.Expect]:
+		result.Failure = fmt.Sprintf("expected %s, got %s", expectedStatus[test.Expect], result.Status)
+	case test.Expect == "" && !halted:
+		result.Failure = fmt.Sprintf("expected the machine to halt, got %s", result.Status)
+	case test.HasTape && result.Tape != test.Tape:
+		result.Failure = fmt.Sprintf("expected tape %q, got %q", test.Tape, result.Tape)
+	}
+	result.Passed = result.Failure == ""
+	return result
+}
+
+// ParseTests reads a test suite kept apart from the programs it tests: a
+// file holding a TESTS section, in the same syntax as inside a program.
+func ParseTests(source string) ([]TestCase, Diagnostics) {
+	ir, diagnostics := parseSource(source, "", true)
+	for _, section := range []string{"CONFIG:", "MACROS:", "MAIN:"} {
+		if span, exists := ir.Sections[section]; exists {
+			diagnostics = append(diagnostics, newWarning(CodeIgnoredSection, span, "Section %s of a test suite is ignored, only its TESTS are used", section))
+		}
+	}
+	if _, exists := ir.Sections["TESTS:"]; !exists {
+		fileStart := Span{Start: Position{1, 1}, End: Position{1, 1}}
+		diagnostics = append(diagnostics, newError(CodeMissingSection, fileStart, "Test suite must contain a TESTS section"))
+	}
+	diagnostics.Sort()
+	return ir.Tests, diagnostics
+}